@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/openshift/node-observability-agent/pkg/collectors"
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
 	"github.com/openshift/node-observability-agent/pkg/server"
 	ver "github.com/openshift/node-observability-agent/pkg/version"
 )
@@ -26,7 +32,19 @@ var (
 	crioPreferUnixSocket = flag.Bool("crioPreferUnixSocket", true, "use unix socket to communicate to CRIO")
 	logLevel             = flag.String("loglevel", "info", "log level")
 	versionFlag          = flag.Bool("v", false, "print version")
-	mode                 = flag.String("mode", "profiling", "flag (profiling or scripting) to set mode (crio,kubelet) profiling or metrics script execution")
+	mode                 = flag.String("mode", "profiling", "flag (profiling, scripting or profiling,scripting) to set mode (crio,kubelet) profiling, metrics script execution or both")
+	traceMaxBytes        = flag.Int64("traceMaxBytes", 100<<20, "size in bytes above which a kubelet or CRIO execution trace is discarded (default: 100MiB)")
+	pprofTargetsFile     = flag.String("pprofTargets", "", "JSON file declaring extra pprof targets profiled alongside kubelet and CRIO")
+	adminTokenFile       = flag.String("adminTokenFile", "", "file containing the bearer token required to clear the error state of the agent, the endpoint is disabled if not set")
+	scriptCatalog        = flag.String("scriptCatalog", "", "folder holding the scripts which can be run by name, declared in its catalog.json file")
+	scriptCgroupParent   = flag.String("scriptCgroupParent", "", "cgroup v2 directory, with the cpu and memory controllers enabled, under which the scripts declaring cgroup limits are run")
+	scriptDigests        = flag.String("scriptDigests", "", "file listing the SHA-256 digests of the scripts which can be run, in the sha256sum format, all scripts can be run if not set")
+	scriptDigestsKey     = flag.String("scriptDigestsKey", "", "PEM file of the ed25519 public key verifying the <scriptDigests>.sig signature of the digests file")
+	procRoot             = flag.String("procRoot", procfs.DefaultRoot, "mount point of the procfs of the host read by the samplers, such as /host/proc in a container (default: /proc)")
+	sysRoot              = flag.String("sysRoot", collectors.DefaultSysRoot, "mount point of the sysfs of the host read by the samplers, such as /host/sys in a container (default: /sys)")
+	cgroupRoot           = flag.String("cgroupRoot", "", "mount point of the cgroup v2 hierarchy of the host read by the samplers (default: <sysRoot>/fs/cgroup)")
+	queueSize            = flag.Int("queueSize", 0, "number of run requests queued while a run is ongoing, requests are rejected with HTTP 409 if 0 (default: 0)")
+	writeTimeout         = flag.Duration("writeTimeout", 40*time.Second, "maximum duration for sending a response, to be raised for downloading large artifacts (default: 40s)")
 )
 
 func main() {
@@ -49,11 +67,21 @@ func main() {
 	log.SetLevel(lvl)
 	log.Infof("Starting %s at log level %s", ver.MakeVersionString(), *logLevel)
 
-	checkParameters(*mode, nodeIP, *storageFolder, *crioUnixSocket, *crioPreferUnixSocket, *caCertFile)
+	checkParameters(*mode, nodeIP, *storageFolder, *crioUnixSocket, *crioPreferUnixSocket, *caCertFile, *scriptCatalog)
+	// the scripts run in the output directories of the storage folder, exported as OUTPUT_DIR:
+	// a relative storage folder would be resolved from these directories
+	*storageFolder, err = filepath.Abs(*storageFolder)
+	if err != nil {
+		panic("Unable to resolve the storage folder :" + err.Error())
+	}
+	// the modes were validated by checkParameters
+	modes, _ := server.ParseModes(*mode)
 
 	var token string
 	var caCerts *x509.CertPool
-	if *mode == "profiling" {
+	var pprofTargets []*collectors.PprofTarget
+	roots := collectors.Roots{Proc: *procRoot, Sys: *sysRoot, Cgroup: *cgroupRoot}
+	if modes.Profiling {
 		/* #nosec G304 tokenFile is a parameter of the agent’s go program.
 		*  Upon creation of the NodeObservability CR, the operator creates a SA for the agent, sets its RBAC,
 		* and provides the tokenFile parameter in the daemonset manifest: The value provided is the default file
@@ -69,6 +97,67 @@ func main() {
 		if err != nil {
 			panic("Unable to read caCerts file :" + err.Error())
 		}
+
+		if *pprofTargetsFile != "" {
+			pprofTargets, err = collectors.LoadPprofTargets(*pprofTargetsFile, *traceMaxBytes)
+			if err != nil {
+				panic("Unable to load pprof targets :" + err.Error())
+			}
+		}
+
+		if err := roots.Check(); err != nil {
+			panic("Unable to read the host filesystems :" + err.Error())
+		}
+	}
+
+	var catalog *scripts.Catalog
+	if modes.Scripting && *scriptCatalog != "" {
+		catalog, err = scripts.LoadCatalog(*scriptCatalog)
+		if err != nil {
+			panic("Unable to load the script catalog :" + err.Error())
+		}
+		for _, s := range catalog.Scripts {
+			if s.Limits.NeedsCgroup() && *scriptCgroupParent == "" {
+				panic(fmt.Sprintf("Script %q declares cgroup limits, but no --scriptCgroupParent is configured", s.Name))
+			}
+		}
+	}
+
+	var allowlist *scripts.Allowlist
+	if modes.Scripting && *scriptDigests != "" {
+		allowlist, err = scripts.LoadAllowlist(*scriptDigests, *scriptDigestsKey)
+		if err != nil {
+			panic("Unable to load the script digests :" + err.Error())
+		}
+		// the scripts are verified again before each execution
+		if script := os.Getenv("EXECUTE_SCRIPT"); script != "" {
+			// the verified copy of the script is run instead of the command
+			if strings.ContainsAny(script, " \t\n") {
+				panic("EXECUTE_SCRIPT must be the path of a listed script, without arguments, when --scriptDigests is set")
+			}
+			for _, path := range append([]string{script}, allowlist.Helpers(script)...) {
+				if err := allowlist.Verify(path); err != nil {
+					panic("Unable to verify EXECUTE_SCRIPT :" + err.Error())
+				}
+			}
+		}
+		if catalog != nil {
+			for _, s := range catalog.Scripts {
+				for _, path := range append([]string{s.Path()}, s.HelperPaths()...) {
+					if err := allowlist.Verify(path); err != nil {
+						panic(fmt.Sprintf("Unable to verify script %q :%s", s.Name, err.Error()))
+					}
+				}
+			}
+		}
+	}
+
+	var adminToken string
+	if *adminTokenFile != "" {
+		adminToken, err = readTokenFile(*adminTokenFile)
+		if err != nil {
+			panic("Unable to read admin token file, or token is empty :" + err.Error())
+		}
 	}
 
 	if err := server.Start(server.Config{
@@ -76,20 +165,34 @@ func main() {
 		UnixSocket:           *unixSocket,
 		PreferUnixSocket:     *preferUnixSocket,
 		Token:                token,
+		AdminToken:           adminToken,
 		CACerts:              caCerts,
 		StorageFolder:        *storageFolder,
 		CrioUnixSocket:       *crioUnixSocket,
 		CrioPreferUnixSocket: *crioPreferUnixSocket,
 		NodeIP:               nodeIP,
 		Mode:                 *mode,
+		TraceMaxBytes:        *traceMaxBytes,
+		PprofTargets:         pprofTargets,
+		Roots:                roots,
+		WriteTimeout:         *writeTimeout,
+		QueueSize:            *queueSize,
+		ScriptCatalog:        catalog,
+		ScriptCgroupParent:   *scriptCgroupParent,
+		ScriptAllowlist:      allowlist,
 	}); err != nil {
 		log.Errorf("Error from server: %s", err.Error())
 	}
 	log.Info("Stopped")
 }
 
-func checkParameters(mode, nodeIP, storageFolder, crioUnixSocket string, crioPreferUnixSocket bool, caCertFile string) {
+func checkParameters(mode, nodeIP, storageFolder, crioUnixSocket string, crioPreferUnixSocket bool, caCertFile, scriptCatalog string) {
 	//check on configs that are passed along before starting up the server
+	// mode is a list of known modes, only the parameters of the enabled modes are checked
+	modes, err := server.ParseModes(mode)
+	if err != nil {
+		panic(err.Error())
+	}
 	// nodeIP is found
 	if nodeIP == "" || net.ParseIP(nodeIP) == nil {
 		panic("Environment variable NODE_IP not found, or doesn't contain a valid IP address")
@@ -99,7 +202,7 @@ func checkParameters(mode, nodeIP, storageFolder, crioUnixSocket string, crioPre
 		panic(fmt.Sprintf("Unable to access the storage folder for saving the profiling data %q: %v", storageFolder, err))
 	}
 
-	if mode == "profiling" {
+	if modes.Profiling {
 		// CRIO socket is accessible in readwrite
 		if crioPreferUnixSocket {
 			if err := syscall.Access(crioUnixSocket, syscall.O_RDWR); err != nil {
@@ -112,9 +215,10 @@ func checkParameters(mode, nodeIP, storageFolder, crioUnixSocket string, crioPre
 			panic("Unable to read the caCerts file :" + caCertFile)
 		}
 
-	} else if mode == "scripting" {
-		if os.Getenv("EXECUTE_SCRIPT") == "" {
-			panic("Ensure the EXECUTE_SCRIPT envar is set (name of script to execute)")
+	}
+	if modes.Scripting {
+		if os.Getenv("EXECUTE_SCRIPT") == "" && scriptCatalog == "" {
+			panic("Ensure the EXECUTE_SCRIPT envar is set (name of script to execute), or a script catalog is configured")
 		}
 	}
 }
@@ -0,0 +1,177 @@
+package cgroupfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FS reads the files of a cgroup v2 hierarchy mounted at its root
+type FS struct {
+	root string
+}
+
+// NewFS returns the cgroup v2 hierarchy mounted at root
+func NewFS(root string) FS {
+	return FS{root: root}
+}
+
+// Root returns the mount point of the hierarchy
+func (fs FS) Root() string {
+	return fs.root
+}
+
+// Path returns the path of the given cgroup, or file of a cgroup, relative to the root
+func (fs FS) Path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// readFile reads the given file of a cgroup
+func (fs FS) readFile(cgroup, file string) ([]byte, error) {
+	/* #nosec G304 the files are read from the cgroup hierarchy */
+	return os.ReadFile(fs.Path(cgroup, file))
+}
+
+// IsV2 returns an error if the root isn't the root of a cgroup v2 hierarchy
+func (fs FS) IsV2() error {
+	if _, err := os.Stat(fs.Path("cgroup.controllers")); err != nil {
+		return fmt.Errorf("%s is not a cgroup v2 hierarchy: %w", fs.root, err)
+	}
+	return nil
+}
+
+// Children returns the names of the child cgroups of the given cgroup
+func (fs FS) Children(cgroup string) ([]string, error) {
+	entries, err := os.ReadDir(fs.Path(cgroup))
+	if err != nil {
+		return nil, err
+	}
+	children := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			children = append(children, e.Name())
+		}
+	}
+	return children, nil
+}
+
+// Uint reads a file holding a single value, such as memory.current
+func (fs FS) Uint(cgroup, file string) (uint64, error) {
+	content, err := fs.readFile(cgroup, file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// FlatKeyed reads a file of "key value" lines, such as cpu.stat or memory.events
+func (fs FS) FlatKeyed(cgroup, file string) (map[string]uint64, error) {
+	content, err := fs.readFile(cgroup, file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s in %s: %w", fields[0], fs.Path(cgroup, file), err)
+		}
+		values[fields[0]] = v
+	}
+	return values, scanner.Err()
+}
+
+// NestedKeyed reads a file of "key subkey=value..." lines, such as io.stat keyed by device major:minor
+func (fs FS) NestedKeyed(cgroup, file string) (map[string]map[string]uint64, error) {
+	content, err := fs.readFile(cgroup, file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		values[fields[0]] = map[string]uint64{}
+		for _, f := range fields[1:] {
+			key, value, ok := strings.Cut(f, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s in %s: %w", key, fs.Path(cgroup, file), err)
+			}
+			values[fields[0]][key] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// PressureStat holds the share of time some or all the tasks of a cgroup were stalled on a resource,
+// in percents over the last 10, 60 and 300 seconds, and the total stall time in microseconds
+type PressureStat struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Pressure holds the pressure stall information of a resource, Full is nil if not reported
+type Pressure struct {
+	Some PressureStat
+	Full *PressureStat
+}
+
+// Pressure reads the <resource>.pressure file of a cgroup, resource being cpu, memory or io
+func (fs FS) Pressure(cgroup, resource string) (Pressure, error) {
+	file := resource + ".pressure"
+	content, err := fs.readFile(cgroup, file)
+	if err != nil {
+		return Pressure{}, err
+	}
+	var p Pressure
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 {
+			continue
+		}
+		var stat PressureStat
+		for _, f := range fields[1:] {
+			key, value, _ := strings.Cut(f, "=")
+			switch key {
+			case "avg10":
+				stat.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				stat.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				stat.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				stat.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return Pressure{}, fmt.Errorf("invalid %s in %s: %w", key, fs.Path(cgroup, file), err)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			p.Some = stat
+		case "full":
+			full := stat
+			p.Full = &full
+		}
+	}
+	return p, scanner.Err()
+}
@@ -0,0 +1,129 @@
+package cgroupfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFixture writes the given files, by path relative to the root, into a temporary cgroup hierarchy
+func writeFixture(t *testing.T, files map[string]string) FS {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewFS(root)
+}
+
+func TestHierarchy(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"cgroup.controllers":              "cpu io memory pids\n",
+		"kubepods.slice/cpu.stat":         "usage_usec 10\n",
+		"system.slice/crio.service/tasks": "",
+	})
+	if err := fs.IsV2(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := writeFixture(t, map[string]string{"cpu/cpu.shares": "1024\n"}).IsV2(); err == nil {
+		t.Error("expected error for a cgroup v1 hierarchy but got none")
+	}
+
+	children, err := fs.Children("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"kubepods.slice", "system.slice"}; !reflect.DeepEqual(expected, children) {
+		t.Errorf("expected children %v but got %v", expected, children)
+	}
+}
+
+func TestStatFiles(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"pod/cpu.stat": `usage_usec 1800000
+nr_periods 42000
+nr_throttled 4200
+throttled_usec 96000000
+`,
+		"pod/memory.current": "536870912\n",
+		"pod/memory.max":     "max\n",
+		"pod/io.stat": `252:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0
+8:0 rbytes=0 wbytes=512 rios=0 wios=1 dbytes=0 dios=0
+`,
+		"invalid/cpu.stat": "usage_usec abc\n",
+	})
+
+	cpu, err := fs.FlatKeyed("pod", "cpu.stat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedCPU := map[string]uint64{"usage_usec": 1800000, "nr_periods": 42000, "nr_throttled": 4200, "throttled_usec": 96000000}
+	if !reflect.DeepEqual(expectedCPU, cpu) {
+		t.Errorf("expected cpu.stat %v but got %v", expectedCPU, cpu)
+	}
+	if _, err := fs.FlatKeyed("invalid", "cpu.stat"); err == nil {
+		t.Error("expected error parsing an invalid value but got none")
+	}
+
+	current, err := fs.Uint("pod", "memory.current")
+	if err != nil || current != 536870912 {
+		t.Errorf("expected memory.current 536870912 but got %d, %v", current, err)
+	}
+	if _, err := fs.Uint("pod", "memory.max"); err == nil {
+		t.Error("expected error reading max as an integer but got none")
+	}
+
+	io, err := fs.NestedKeyed("pod", "io.stat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedIO := map[string]map[string]uint64{
+		"252:0": {"rbytes": 4096, "wbytes": 8192, "rios": 1, "wios": 2, "dbytes": 0, "dios": 0},
+		"8:0":   {"rbytes": 0, "wbytes": 512, "rios": 0, "wios": 1, "dbytes": 0, "dios": 0},
+	}
+	if !reflect.DeepEqual(expectedIO, io) {
+		t.Errorf("expected io.stat %v but got %v", expectedIO, io)
+	}
+}
+
+func TestPressure(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"pod/memory.pressure": `some avg10=24.75 avg60=6.10 avg300=1.30 total=4100000
+full avg10=20.00 avg60=5.00 avg300=1.00 total=3800000
+`,
+		// older kernels don't report full for cpu
+		"pod/cpu.pressure":     "some avg10=0.50 avg60=0.00 avg300=0.00 total=1200\n",
+		"invalid/cpu.pressure": "some avg10=abc avg60=0.00 avg300=0.00 total=1200\n",
+	})
+
+	memory, err := fs.Pressure("pod", "memory")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Pressure{
+		Some: PressureStat{Avg10: 24.75, Avg60: 6.10, Avg300: 1.30, Total: 4100000},
+		Full: &PressureStat{Avg10: 20, Avg60: 5, Avg300: 1, Total: 3800000},
+	}
+	if !reflect.DeepEqual(expected, memory) {
+		t.Errorf("expected memory pressure %+v but got %+v", expected, memory)
+	}
+
+	cpu, err := fs.Pressure("pod", "cpu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.Full != nil || cpu.Some.Avg10 != 0.5 || cpu.Some.Total != 1200 {
+		t.Errorf("unexpected cpu pressure %+v", cpu)
+	}
+
+	if _, err := fs.Pressure("invalid", "cpu"); err == nil {
+		t.Error("expected error parsing an invalid average but got none")
+	}
+}
@@ -0,0 +1,103 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+var clog = logrus.WithField("module", "collectors")
+
+// Collector gathers one piece of diagnostic data during a run
+type Collector interface {
+	// Name identifies the collector in logs
+	Name() string
+	// Type returns the type of the execution run produced by Collect
+	Type() runs.RunType
+	// Collect gathers the data of run runID, saves it into outputDir and returns
+	// the resulting execution run. It must return as soon as ctx is done.
+	Collect(ctx context.Context, runID string, outputDir string) runs.ExecutionRun
+}
+
+// Params holds the parameters of a run from which the collectors are built
+type Params struct {
+	// Profiles maps a pprof target to the profile types to collect from it
+	Profiles map[string][]ProfileType
+	// Seconds is the duration of the CPU profiles and execution traces, and of the samplings
+	Seconds int
+	// Samplers are the names of the native samplers of the run
+	Samplers []string
+	// Resolution is the interval between two samples, defaults to DefaultResolution
+	Resolution time.Duration
+}
+
+// HasSampler returns true if the sampler of the given name is part of the run
+func (p Params) HasSampler(name string) bool {
+	for _, s := range p.Samplers {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolution returns the interval between two samples
+func (p Params) resolution() time.Duration {
+	if p.Resolution <= 0 {
+		return DefaultResolution
+	}
+	return p.Resolution
+}
+
+// Factory builds the collectors of a data source for the given run parameters.
+// It returns no collector if the data source is not part of the run.
+type Factory func(params Params) []Collector
+
+// Registry holds the data sources enabled in the agent.
+// Data sources are registered at startup: Register must not be called
+// concurrently with the other methods.
+type Registry struct {
+	names     []string
+	factories map[string]Factory
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: map[string]Factory{},
+	}
+}
+
+// Register adds a data source under the given name
+func (r *Registry) Register(name string, factory Factory) error {
+	if _, exists := r.factories[name]; exists {
+		return fmt.Errorf("data source %q is already registered", name)
+	}
+	r.names = append(r.names, name)
+	r.factories[name] = factory
+	return nil
+}
+
+// Has returns true if a data source is registered under the given name
+func (r *Registry) Has(name string) bool {
+	_, exists := r.factories[name]
+	return exists
+}
+
+// Names returns the names of the registered data sources, in registration order
+func (r *Registry) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// Collectors returns the collectors of all the data sources for the given run parameters
+func (r *Registry) Collectors(params Params) []Collector {
+	collectors := []Collector{}
+	for _, name := range r.names {
+		collectors = append(collectors, r.factories[name](params)...)
+	}
+	return collectors
+}
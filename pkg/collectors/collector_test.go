@@ -0,0 +1,63 @@
+package collectors
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+type fakeCollector struct {
+	name string
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Type() runs.RunType {
+	return runs.UnknownRun
+}
+
+func (c *fakeCollector) Collect(ctx context.Context, runID string, outputDir string) runs.ExecutionRun {
+	return runs.ExecutionRun{Type: runs.UnknownRun, Successful: true}
+}
+
+func fakeFactory(names ...string) Factory {
+	return func(params Params) []Collector {
+		cs := []Collector{}
+		for _, n := range names {
+			cs = append(cs, &fakeCollector{name: n})
+		}
+		return cs
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("first", fakeFactory("a", "b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Register("second", fakeFactory("c")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Register("first", fakeFactory("d")); err == nil {
+		t.Error("expected error registering a data source twice but got none")
+	}
+
+	if !r.Has("second") || r.Has("third") {
+		t.Errorf("wrong registered data sources: %v", r.Names())
+	}
+	if expected, got := []string{"first", "second"}, r.Names(); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected names %v but got %v", expected, got)
+	}
+
+	names := []string{}
+	for _, c := range r.Collectors(Params{}) {
+		names = append(names, c.Name())
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected collectors %v but got %v", expected, names)
+	}
+}
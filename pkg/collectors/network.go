@@ -0,0 +1,170 @@
+package collectors
+
+import (
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// NetworkSampler is the name of the sampler of the network statistics
+const NetworkSampler = "network"
+
+// NetworkSample holds the network statistics at a point in time.
+// The counters are cumulated since boot, Deltas holds their increase since the previous sample.
+type NetworkSample struct {
+	Time     time.Time
+	Counters NetworkCounters
+	// Deltas is nil for the first sample of the run
+	Deltas *NetworkCounters
+	// Interval is the time elapsed since the previous sample
+	Interval time.Duration
+	// Sockstat and Conntrack are the current number of sockets and tracked connections
+	Sockstat  map[string]map[string]int64
+	Conntrack *procfs.Conntrack
+	// Errors lists the statistics which couldn't be read
+	Errors []string
+}
+
+// NetworkCounters holds the network counters of /proc/1/net/snmp, netstat, dev and softnet_stat
+type NetworkCounters struct {
+	SNMP    map[string]map[string]int64
+	Netstat map[string]map[string]int64
+	Dev     map[string]procfs.NetDevStats
+	Softnet []procfs.SoftnetStat
+}
+
+// NewNetworkSamplerFactory returns the factory of the network sampler reading the given procfs,
+// it builds the sampler if NetworkSampler is part of the samplers of the run
+func NewNetworkSamplerFactory(proc procfs.FS) Factory {
+	return func(params Params) []Collector {
+		if !params.HasSampler(NetworkSampler) {
+			return nil
+		}
+		// the previous sample is kept by the sampler of each run to compute the deltas
+		var previous *NetworkSample
+		return []Collector{&sampler{
+			name:       NetworkSampler,
+			runType:    runs.NetworkRun,
+			resolution: params.resolution(),
+			duration:   time.Duration(params.Seconds) * time.Second,
+			sample: func() interface{} {
+				s := sampleNetwork(proc, previous)
+				previous = &s
+				return s
+			},
+		}}
+	}
+}
+
+// sampleNetwork reads the network statistics, and computes the deltas from the previous sample if any
+func sampleNetwork(proc procfs.FS, previous *NetworkSample) NetworkSample {
+	s := NetworkSample{Time: time.Now()}
+	var err error
+	if s.Counters.SNMP, err = proc.SNMP(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Counters.Netstat, err = proc.Netstat(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Counters.Dev, err = proc.NetDev(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Counters.Softnet, err = proc.SoftnetStat(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Sockstat, err = proc.Sockstat(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if conntrack, err := proc.Conntrack(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	} else {
+		s.Conntrack = &conntrack
+	}
+
+	if previous != nil {
+		s.Interval = s.Time.Sub(previous.Time)
+		s.Deltas = &NetworkCounters{
+			SNMP:    protocolDeltas(s.Counters.SNMP, previous.Counters.SNMP),
+			Netstat: protocolDeltas(s.Counters.Netstat, previous.Counters.Netstat),
+			Dev:     devDeltas(s.Counters.Dev, previous.Counters.Dev),
+			Softnet: softnetDeltas(s.Counters.Softnet, previous.Counters.Softnet),
+		}
+	}
+	return s
+}
+
+// protocolDeltas returns the difference of the counters present in both samples.
+// The gauges, such as Tcp CurrEstab, can have negative deltas.
+func protocolDeltas(current, previous map[string]map[string]int64) map[string]map[string]int64 {
+	deltas := map[string]map[string]int64{}
+	for proto, counters := range current {
+		prev, ok := previous[proto]
+		if !ok {
+			continue
+		}
+		deltas[proto] = map[string]int64{}
+		for name, v := range counters {
+			if p, ok := prev[name]; ok {
+				deltas[proto][name] = v - p
+			}
+		}
+	}
+	return deltas
+}
+
+// devDeltas returns the increase of the counters of the interfaces present in both samples
+func devDeltas(current, previous map[string]procfs.NetDevStats) map[string]procfs.NetDevStats {
+	deltas := map[string]procfs.NetDevStats{}
+	for name, c := range current {
+		p, ok := previous[name]
+		if !ok {
+			continue
+		}
+		deltas[name] = procfs.NetDevStats{
+			RxBytes: delta(c.RxBytes, p.RxBytes), RxPackets: delta(c.RxPackets, p.RxPackets),
+			RxErrs: delta(c.RxErrs, p.RxErrs), RxDrop: delta(c.RxDrop, p.RxDrop),
+			RxFifo: delta(c.RxFifo, p.RxFifo), RxFrame: delta(c.RxFrame, p.RxFrame),
+			RxCompressed: delta(c.RxCompressed, p.RxCompressed), RxMulticast: delta(c.RxMulticast, p.RxMulticast),
+			TxBytes: delta(c.TxBytes, p.TxBytes), TxPackets: delta(c.TxPackets, p.TxPackets),
+			TxErrs: delta(c.TxErrs, p.TxErrs), TxDrop: delta(c.TxDrop, p.TxDrop),
+			TxFifo: delta(c.TxFifo, p.TxFifo), TxColls: delta(c.TxColls, p.TxColls),
+			TxCarrier: delta(c.TxCarrier, p.TxCarrier), TxCompressed: delta(c.TxCompressed, p.TxCompressed),
+		}
+	}
+	return deltas
+}
+
+// softnetDeltas returns the increase of the counters of the CPUs present in both samples
+func softnetDeltas(current, previous []procfs.SoftnetStat) []procfs.SoftnetStat {
+	prev := map[int]procfs.SoftnetStat{}
+	for _, p := range previous {
+		prev[p.CPU] = p
+	}
+	deltas := []procfs.SoftnetStat{}
+	for _, c := range current {
+		p, ok := prev[c.CPU]
+		if !ok {
+			continue
+		}
+		deltas = append(deltas, procfs.SoftnetStat{
+			CPU:            c.CPU,
+			Processed:      delta(c.Processed, p.Processed),
+			Dropped:        delta(c.Dropped, p.Dropped),
+			TimeSqueeze:    delta(c.TimeSqueeze, p.TimeSqueeze),
+			CPUCollision:   delta(c.CPUCollision, p.CPUCollision),
+			ReceivedRPS:    delta(c.ReceivedRPS, p.ReceivedRPS),
+			FlowLimitCount: delta(c.FlowLimitCount, p.FlowLimitCount),
+		})
+	}
+	return deltas
+}
+
+// delta returns the increase of a counter, which restarted from 0 if lower than before:
+// the softnet_stat counters are 32 bits and wrap, the interfaces can be recreated
+func delta(current, previous uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
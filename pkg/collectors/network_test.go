@@ -0,0 +1,116 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// writeNetFixture writes the network statistics of a procfs, with the given counters
+func writeNetFixture(t *testing.T, root string, inReceives, rxBytes, processed string) {
+	t.Helper()
+	files := map[string]string{
+		"1/net/snmp":                         "Ip: InReceives\nIp: " + inReceives + "\nTcp: CurrEstab\nTcp: 5\n",
+		"1/net/netstat":                      "TcpExt: ListenOverflows\nTcpExt: 1\n",
+		"1/net/dev":                          "Inter-|\n face |\n  eth0: " + rxBytes + " 10 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n",
+		"1/net/sockstat":                     "TCP: inuse 5\n",
+		"1/net/softnet_stat":                 processed + " 0 0 0 0 0 0 0 0 0 0\n",
+		"1/net/stat/nf_conntrack":            "entries searched\n0000000c 00000000\n",
+		"sys/net/netfilter/nf_conntrack_max": "1024\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNetworkSamplerFactory(t *testing.T) {
+	factory := NewNetworkSamplerFactory(procfs.NewFS(t.TempDir()))
+	if cs := factory(Params{Seconds: 1, Samplers: []string{SystemSampler}}); len(cs) != 0 {
+		t.Errorf("expected no collector when the sampler isn't requested but got %d", len(cs))
+	}
+	cs := factory(Params{Seconds: 1, Samplers: []string{SystemSampler, NetworkSampler}})
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 collector but got %d", len(cs))
+	}
+	if cs[0].Name() != NetworkSampler || cs[0].Type() != runs.NetworkRun {
+		t.Errorf("unexpected collector %s of type %s", cs[0].Name(), cs[0].Type())
+	}
+}
+
+func TestSampleNetwork(t *testing.T) {
+	root := t.TempDir()
+	proc := procfs.NewFS(root)
+
+	writeNetFixture(t, root, "1000", "4000", "ffffffff")
+	first := sampleNetwork(proc, nil)
+	if len(first.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", first.Errors)
+	}
+	if first.Deltas != nil || first.Interval != 0 {
+		t.Errorf("expected no delta for the first sample but got %+v", first.Deltas)
+	}
+	if first.Conntrack == nil || first.Conntrack.Count != 12 || first.Sockstat["TCP"]["inuse"] != 5 {
+		t.Errorf("unexpected gauges %+v and %v", first.Conntrack, first.Sockstat)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	// the softnet_stat counter wrapped
+	writeNetFixture(t, root, "1500", "4096", "00000010")
+	second := sampleNetwork(proc, &first)
+	if len(second.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", second.Errors)
+	}
+	if second.Interval <= 0 {
+		t.Errorf("expected positive interval but got %s", second.Interval)
+	}
+	if second.Deltas == nil {
+		t.Fatal("expected deltas for the second sample")
+	}
+	expected := NetworkCounters{
+		SNMP:    map[string]map[string]int64{"Ip": {"InReceives": 500}, "Tcp": {"CurrEstab": 0}},
+		Netstat: map[string]map[string]int64{"TcpExt": {"ListenOverflows": 0}},
+		Dev:     map[string]procfs.NetDevStats{"eth0": {RxBytes: 96}},
+		Softnet: []procfs.SoftnetStat{{CPU: 0, Processed: 16}},
+	}
+	if !reflect.DeepEqual(expected, *second.Deltas) {
+		t.Errorf("expected deltas %+v but got %+v", expected, *second.Deltas)
+	}
+}
+
+func TestSampleNetworkFixture(t *testing.T) {
+	s := sampleNetwork(procfs.NewFS(testProcRoot), nil)
+	if len(s.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", s.Errors)
+	}
+	if s.Counters.SNMP["Tcp"]["RetransSegs"] != 6100 || s.Counters.Netstat["TcpExt"]["ListenOverflows"] != 3 {
+		t.Errorf("unexpected protocol counters %v and %v", s.Counters.SNMP, s.Counters.Netstat)
+	}
+	if len(s.Counters.Dev) != 3 || s.Counters.Dev["ens3"].RxDrop != 12 || len(s.Counters.Softnet) != 2 {
+		t.Errorf("unexpected device counters %+v and %+v", s.Counters.Dev, s.Counters.Softnet)
+	}
+	if s.Conntrack == nil || *s.Conntrack != (procfs.Conntrack{Count: 1842, Max: 262144}) {
+		t.Errorf("unexpected conntrack %+v", s.Conntrack)
+	}
+}
+
+func TestSampleNetworkMissingFiles(t *testing.T) {
+	s := sampleNetwork(procfs.NewFS(t.TempDir()), nil)
+	// snmp, netstat, dev, softnet_stat, sockstat and conntrack
+	if len(s.Errors) != 6 {
+		t.Errorf("expected 6 errors but got %v", s.Errors)
+	}
+	if s.Conntrack != nil {
+		t.Errorf("expected no conntrack statistics but got %+v", s.Conntrack)
+	}
+}
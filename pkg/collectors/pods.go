@@ -0,0 +1,249 @@
+package collectors
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/cgroupfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// PodSampler is the name of the sampler of the cgroups of the pods
+const PodSampler = "pods"
+
+const (
+	// GuaranteedQOS, BurstableQOS and BestEffortQOS are the QoS classes of the pods,
+	// told by the cgroups of the pods
+	GuaranteedQOS = "Guaranteed"
+	BurstableQOS  = "Burstable"
+	BestEffortQOS = "BestEffort"
+)
+
+var (
+	// kubepodsCgroups are the cgroups of the pods with the systemd and cgroupfs drivers
+	kubepodsCgroups = []string{"kubepods.slice", "kubepods"}
+	// podCgroupRegexp matches kubepods-burstable-pod<uid>.slice with the systemd driver, where the
+	// dashes of the UID are replaced by underscores, and pod<uid> with the cgroupfs driver
+	podCgroupRegexp = regexp.MustCompile(`(?:^|-)pod([0-9a-f_-]+)(?:\.slice)?$`)
+	// containerCgroupRegexp matches crio-<id>.scope with the systemd driver, and <id> with the cgroupfs driver
+	containerCgroupRegexp = regexp.MustCompile(`^(?:(.+)-)?([0-9a-f]{64})(?:\.scope)?$`)
+	// pressureResources are the resources of the pressure stall information
+	pressureResources = []string{"cpu", "memory", "io"}
+)
+
+// PodsSample holds the resource usage of the cgroups of the pods at a point in time
+type PodsSample struct {
+	Time time.Time
+	Pods []PodCgroup
+	// Errors lists the statistics which couldn't be read
+	Errors []string
+}
+
+// PodCgroup holds the resource usage of the cgroup of a pod, and of the cgroups of its containers
+type PodCgroup struct {
+	UID      string
+	QOSClass string
+	// Path is the path of the cgroup from the root of the hierarchy
+	Path string
+	CgroupStats
+	Containers []ContainerCgroup
+}
+
+// ContainerCgroup holds the resource usage of the cgroup of a container, including the sandbox of the pod
+type ContainerCgroup struct {
+	ID string
+	// Runtime is the prefix of the cgroup of the container, such as crio, empty with the cgroupfs driver
+	Runtime string
+	Path    string
+	CgroupStats
+}
+
+// CgroupStats holds the statistics of a cgroup. The statistics of the controllers
+// which aren't enabled for the cgroup, and the pressure without PSI, are missing.
+type CgroupStats struct {
+	// CPU is cpu.stat, the CPU usage and throttling in microseconds
+	CPU map[string]uint64
+	// MemoryCurrent is memory.current in bytes
+	MemoryCurrent *uint64
+	// MemoryEvents is memory.events, the number of times the memory limits were hit
+	MemoryEvents map[string]uint64
+	// IO is io.stat, the bytes and operations of each device major:minor
+	IO map[string]map[string]uint64
+	// Pressure is the pressure stall information of the cpu, memory and io resources
+	Pressure map[string]cgroupfs.Pressure
+}
+
+// NewPodSamplerFactory returns the factory of the sampler of the cgroups of the pods reading the given
+// cgroup v2 hierarchy, it builds the sampler if PodSampler is part of the samplers of the run
+func NewPodSamplerFactory(cgroups cgroupfs.FS) Factory {
+	return func(params Params) []Collector {
+		if !params.HasSampler(PodSampler) {
+			return nil
+		}
+		return []Collector{&sampler{
+			name:       PodSampler,
+			runType:    runs.PodRun,
+			resolution: params.resolution(),
+			duration:   time.Duration(params.Seconds) * time.Second,
+			sample: func() interface{} {
+				return samplePods(cgroups)
+			},
+		}}
+	}
+}
+
+// samplePods walks the kubepods cgroup and reads the statistics of the cgroups of the pods and their containers
+func samplePods(cgroups cgroupfs.FS) PodsSample {
+	s := PodsSample{Time: time.Now(), Pods: []PodCgroup{}}
+	if err := cgroups.IsV2(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+		return s
+	}
+	found := false
+	for _, kubepods := range kubepodsCgroups {
+		pods, err := findPods(cgroups, kubepods)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		found = true
+		if err != nil {
+			s.Errors = append(s.Errors, err.Error())
+			continue
+		}
+		for _, pod := range pods {
+			if p, ok := samplePod(cgroups, pod, &s.Errors); ok {
+				s.Pods = append(s.Pods, p)
+			}
+		}
+	}
+	if !found {
+		s.Errors = append(s.Errors, "no kubepods cgroup found in "+cgroups.Root())
+	}
+	return s
+}
+
+// findPods returns the cgroups of the pods under the kubepods cgroup, directly for the
+// Guaranteed pods or under the cgroups of the Burstable and BestEffort QoS classes
+func findPods(cgroups cgroupfs.FS, kubepods string) ([]PodCgroup, error) {
+	pods := []PodCgroup{}
+	children, err := cgroups.Children(kubepods)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if uid, ok := podUID(child); ok {
+			pods = append(pods, PodCgroup{UID: uid, QOSClass: GuaranteedQOS, Path: path.Join(kubepods, child)})
+			continue
+		}
+		qos := qosClass(child)
+		if qos == "" {
+			continue
+		}
+		qosChildren, err := cgroups.Children(path.Join(kubepods, child))
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range qosChildren {
+			if uid, ok := podUID(pod); ok {
+				pods = append(pods, PodCgroup{UID: uid, QOSClass: qos, Path: path.Join(kubepods, child, pod)})
+			}
+		}
+	}
+	return pods, nil
+}
+
+// samplePod reads the statistics of a pod and of its containers, it returns false if the pod was removed
+func samplePod(cgroups cgroupfs.FS, pod PodCgroup, errs *[]string) (PodCgroup, bool) {
+	var ok bool
+	if pod.CgroupStats, ok = readCgroupStats(cgroups, pod.Path, errs); !ok {
+		return pod, false
+	}
+	children, err := cgroups.Children(pod.Path)
+	if err != nil {
+		*errs = append(*errs, err.Error())
+		return pod, true
+	}
+	pod.Containers = []ContainerCgroup{}
+	for _, child := range children {
+		m := containerCgroupRegexp.FindStringSubmatch(child)
+		// the cgroups of conmon, the monitor of the containers of CRIO, aren't the ones of the containers
+		if m == nil || strings.HasSuffix(m[1], "conmon") {
+			continue
+		}
+		c := ContainerCgroup{ID: m[2], Runtime: m[1], Path: path.Join(pod.Path, child)}
+		if c.CgroupStats, ok = readCgroupStats(cgroups, c.Path, errs); ok {
+			pod.Containers = append(pod.Containers, c)
+		}
+	}
+	return pod, true
+}
+
+// readCgroupStats reads the statistics of a cgroup, it returns false if the cgroup was removed.
+// The files of the controllers which aren't enabled don't exist, and the pressure files can't be read
+// without PSI: they aren't reported as errors.
+func readCgroupStats(cgroups cgroupfs.FS, cgroup string, errs *[]string) (CgroupStats, bool) {
+	var stats CgroupStats
+	var err error
+	// cpu.stat exists in all the cgroups
+	if stats.CPU, err = cgroups.FlatKeyed(cgroup, "cpu.stat"); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			*errs = append(*errs, err.Error())
+		}
+		return stats, false
+	}
+	if current, err := cgroups.Uint(cgroup, "memory.current"); err == nil {
+		stats.MemoryCurrent = &current
+	} else if !isUnavailable(err) {
+		*errs = append(*errs, err.Error())
+	}
+	if stats.MemoryEvents, err = cgroups.FlatKeyed(cgroup, "memory.events"); err != nil && !isUnavailable(err) {
+		*errs = append(*errs, err.Error())
+	}
+	if stats.IO, err = cgroups.NestedKeyed(cgroup, "io.stat"); err != nil && !isUnavailable(err) {
+		*errs = append(*errs, err.Error())
+	}
+	for _, resource := range pressureResources {
+		p, err := cgroups.Pressure(cgroup, resource)
+		if err != nil {
+			if !isUnavailable(err) {
+				*errs = append(*errs, err.Error())
+			}
+			continue
+		}
+		if stats.Pressure == nil {
+			stats.Pressure = map[string]cgroupfs.Pressure{}
+		}
+		stats.Pressure[resource] = p
+	}
+	return stats, true
+}
+
+// isUnavailable returns true if the file of a statistic doesn't exist, or isn't supported by the kernel
+func isUnavailable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// podUID returns the UID of the pod of the given cgroup, if it's the cgroup of a pod
+func podUID(cgroup string) (string, bool) {
+	m := podCgroupRegexp.FindStringSubmatch(cgroup)
+	if m == nil {
+		return "", false
+	}
+	return strings.ReplaceAll(m[1], "_", "-"), true
+}
+
+// qosClass returns the QoS class of the cgroup holding the pods of a class, empty for the other cgroups
+func qosClass(cgroup string) string {
+	switch {
+	case strings.Contains(cgroup, "burstable"):
+		return BurstableQOS
+	case strings.Contains(cgroup, "besteffort"):
+		return BestEffortQOS
+	}
+	return ""
+}
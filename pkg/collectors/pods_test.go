@@ -0,0 +1,166 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openshift/node-observability-agent/pkg/cgroupfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// testCgroupRoot is the cgroup v2 fixture of a node using the systemd driver
+const testCgroupRoot = "../../test_resources/host/sys/fs/cgroup"
+
+func TestPodSamplerFactory(t *testing.T) {
+	factory := NewPodSamplerFactory(cgroupfs.NewFS(testCgroupRoot))
+	if cs := factory(Params{Seconds: 1, Samplers: []string{SystemSampler}}); len(cs) != 0 {
+		t.Errorf("expected no collector when the pod sampler isn't requested but got %d", len(cs))
+	}
+	cs := factory(Params{Seconds: 1, Samplers: []string{PodSampler}})
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 collector but got %d", len(cs))
+	}
+	if cs[0].Name() != PodSampler || cs[0].Type() != runs.PodRun {
+		t.Errorf("unexpected collector %s of type %s", cs[0].Name(), cs[0].Type())
+	}
+}
+
+func TestSamplePods(t *testing.T) {
+	s := samplePods(cgroupfs.NewFS(testCgroupRoot))
+	if len(s.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", s.Errors)
+	}
+	pods := map[string]PodCgroup{}
+	for _, p := range s.Pods {
+		pods[p.UID] = p
+	}
+	if len(pods) != 4 {
+		t.Fatalf("expected 4 pods but got %+v", s.Pods)
+	}
+
+	testCases := []struct {
+		uid                string
+		expectedQOS        string
+		expectedContainers int
+	}{
+		{uid: "8f2c1d4e-6b7a-4c3d-9e1f-2a3b4c5d6e7f", expectedQOS: GuaranteedQOS, expectedContainers: 2},
+		{uid: "1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c", expectedQOS: BurstableQOS, expectedContainers: 1},
+		// the UIDs of the static pods are hashes
+		{uid: "b8d2b7c4c8bd7f44e3c1d6f8a2a53b6c", expectedQOS: BurstableQOS, expectedContainers: 1},
+		{uid: "4d3c2b1a-9f8e-4d7c-b6a5-0f1e2d3c4b5a", expectedQOS: BestEffortQOS, expectedContainers: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.uid, func(t *testing.T) {
+			p, ok := pods[tc.uid]
+			if !ok {
+				t.Fatalf("pod %s not found", tc.uid)
+			}
+			if p.QOSClass != tc.expectedQOS {
+				t.Errorf("expected QoS class %s but got %s", tc.expectedQOS, p.QOSClass)
+			}
+			if len(p.Containers) != tc.expectedContainers {
+				t.Errorf("expected %d containers but got %+v", tc.expectedContainers, p.Containers)
+			}
+			for _, c := range p.Containers {
+				if c.Runtime != "crio" || len(c.ID) != 64 || !strings.HasPrefix(c.Path, p.Path+"/") {
+					t.Errorf("unexpected container %+v", c)
+				}
+			}
+			if p.CPU == nil || p.MemoryCurrent == nil || p.MemoryEvents == nil {
+				t.Errorf("missing statistics of pod %+v", p)
+			}
+		})
+	}
+
+	guaranteed := pods["8f2c1d4e-6b7a-4c3d-9e1f-2a3b4c5d6e7f"]
+	if guaranteed.CPU["nr_throttled"] != 4200 || guaranteed.CPU["throttled_usec"] != 96000000 {
+		t.Errorf("unexpected throttling of the guaranteed pod %v", guaranteed.CPU)
+	}
+	burstable := pods["1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c"]
+	if burstable.MemoryEvents["oom_kill"] != 2 || burstable.Pressure["memory"].Some.Avg10 != 24.75 {
+		t.Errorf("unexpected memory events and pressure of the burstable pod %+v", burstable.CgroupStats)
+	}
+	bestEffort := pods["4d3c2b1a-9f8e-4d7c-b6a5-0f1e2d3c4b5a"]
+	if bestEffort.IO != nil || bestEffort.Pressure != nil {
+		t.Errorf("expected no io and pressure statistics of the besteffort pod but got %+v", bestEffort.CgroupStats)
+	}
+}
+
+func TestSamplePodsCgroupfsDriver(t *testing.T) {
+	root := t.TempDir()
+	id := strings.Repeat("ab", 32)
+	files := map[string]string{
+		"cgroup.controllers": "cpu io memory pids\n",
+		"kubepods/burstable/pod1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c/cpu.stat":            "usage_usec 100\n",
+		"kubepods/burstable/pod1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c/" + id + "/cpu.stat": "usage_usec 80\n",
+		// the cgroup of a container being removed
+		"kubepods/burstable/pod1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c/" + strings.Repeat("cd", 32) + "/cgroup.procs": "",
+		"kubepods/burstable/pod1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c/memory.current":                                "4096\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := samplePods(cgroupfs.NewFS(root))
+	if len(s.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", s.Errors)
+	}
+	if len(s.Pods) != 1 {
+		t.Fatalf("expected 1 pod but got %+v", s.Pods)
+	}
+	p := s.Pods[0]
+	if p.UID != "1c9e3a57-0d2b-4f8e-a6c4-7b5d9e1f3a2c" || p.QOSClass != BurstableQOS || *p.MemoryCurrent != 4096 {
+		t.Errorf("unexpected pod %+v", p)
+	}
+	if len(p.Containers) != 1 || p.Containers[0].ID != id || p.Containers[0].Runtime != "" || p.Containers[0].CPU["usage_usec"] != 80 {
+		t.Errorf("unexpected containers %+v", p.Containers)
+	}
+}
+
+func TestSamplePodsErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			name:          "Cgroup v1 hierarchy",
+			files:         map[string]string{"cpu,cpuacct/kubepods.slice/cpu.shares": "1024\n"},
+			expectedError: "is not a cgroup v2 hierarchy",
+		},
+		{
+			name:          "No kubepods cgroup",
+			files:         map[string]string{"cgroup.controllers": "cpu io memory pids\n", "system.slice/cpu.stat": "usage_usec 10\n"},
+			expectedError: "no kubepods cgroup found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tc.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := samplePods(cgroupfs.NewFS(root))
+			if len(s.Pods) != 0 {
+				t.Errorf("expected no pod but got %+v", s.Pods)
+			}
+			if len(s.Errors) != 1 || !strings.Contains(s.Errors[0], tc.expectedError) {
+				t.Errorf("expected error containing %q but got %v", tc.expectedError, s.Errors)
+			}
+		})
+	}
+}
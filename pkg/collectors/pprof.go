@@ -0,0 +1,332 @@
+package collectors
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+const (
+	defaultCrioHost    = "localhost"
+	defaultCrioPort    = "6060"
+	defaultKubeletPort = "10250"
+	pprofBasePath      = "debug/pprof"
+	pprofFileExt       = "pprof"
+	traceFileExt       = "trace"
+	// KubeletTarget is the name of the kubelet pprof target
+	KubeletTarget = "kubelet"
+	// CrioTarget is the name of the CRIO pprof target
+	CrioTarget = "crio"
+)
+
+// ProfileType is the name of a profile served by the pprof endpoints of a target
+type ProfileType string
+
+const (
+	CPUProfile          ProfileType = "profile"
+	HeapProfile         ProfileType = "heap"
+	AllocsProfile       ProfileType = "allocs"
+	GoroutineProfile    ProfileType = "goroutine"
+	BlockProfile        ProfileType = "block"
+	MutexProfile        ProfileType = "mutex"
+	ThreadCreateProfile ProfileType = "threadcreate"
+	// TraceProfile is the Go execution trace, it's recorded as a runs.TraceRun
+	TraceProfile ProfileType = "trace"
+)
+
+var validProfileTypes = map[ProfileType]bool{
+	CPUProfile:          true,
+	HeapProfile:         true,
+	AllocsProfile:       true,
+	GoroutineProfile:    true,
+	BlockProfile:        true,
+	MutexProfile:        true,
+	ThreadCreateProfile: true,
+	TraceProfile:        true,
+}
+
+// IsValid returns true if p is a profile type served by the pprof endpoints
+func (p ProfileType) IsValid() bool {
+	return validProfileTypes[p]
+}
+
+// PprofTarget is a Go program exposing the net/http/pprof endpoints
+type PprofTarget struct {
+	// Name of the target, used as prefix of the output files
+	Name string
+	// RunType is the type of the profiling runs of the target
+	RunType runs.RunType
+	// BaseURL holds the scheme and host of the pprof endpoints
+	BaseURL url.URL
+	// Token is sent as bearer token if not empty
+	Token string
+	// Client is the HTTP client used to reach the target
+	Client *http.Client
+	// TraceMaxBytes is the size above which an execution trace is discarded
+	TraceMaxBytes int64
+}
+
+// NewKubeletTarget creates the pprof target of the kubelet running on nodeIP
+func NewKubeletTarget(nodeIP, token string, caCerts *x509.CertPool, traceMaxBytes int64) *PprofTarget {
+	return &PprofTarget{
+		Name:    KubeletTarget,
+		RunType: runs.KubeletRun,
+		BaseURL: url.URL{
+			Scheme: "https",
+			Host:   net.JoinHostPort(nodeIP, defaultKubeletPort),
+		},
+		Token: token,
+		Client: &http.Client{
+			Transport: newDefaultHTTPTransport().withRootCAs(caCerts).build(),
+		},
+		TraceMaxBytes: traceMaxBytes,
+	}
+}
+
+// NewCrioTarget creates the pprof target of CRIO, reached on localhost or on its unix socket
+func NewCrioTarget(unixSocket string, preferUnixSocket bool, traceMaxBytes int64) *PprofTarget {
+	client := &http.Client{
+		Transport: newDefaultHTTPTransport().build(),
+	}
+	if preferUnixSocket {
+		client.Transport = newDefaultHTTPTransport().withUnixDialContext(unixSocket).build()
+	}
+	return &PprofTarget{
+		Name:    CrioTarget,
+		RunType: runs.CrioRun,
+		BaseURL: url.URL{
+			Scheme: "http",
+			Host:   net.JoinHostPort(defaultCrioHost, defaultCrioPort),
+		},
+		Client:        client,
+		TraceMaxBytes: traceMaxBytes,
+	}
+}
+
+// Factory returns the factory building one collector per profile type requested from the target
+func (t *PprofTarget) Factory() Factory {
+	return func(params Params) []Collector {
+		collectors := []Collector{}
+		for _, profile := range params.Profiles[t.Name] {
+			collectors = append(collectors, &pprofCollector{
+				target:  t,
+				profile: profile,
+				seconds: params.Seconds,
+			})
+		}
+		return collectors
+	}
+}
+
+// pprofCollector collects one profile type from a pprof target
+type pprofCollector struct {
+	target  *PprofTarget
+	profile ProfileType
+	seconds int
+}
+
+// Name implements Collector.Name
+func (c *pprofCollector) Name() string {
+	return c.target.Name + "/" + string(c.profile)
+}
+
+// Type implements Collector.Type
+func (c *pprofCollector) Type() runs.RunType {
+	return profileRunType(c.target.RunType, c.profile)
+}
+
+// Collect implements Collector.Collect, it saves the profile as outputDir/<target>[-<profile>]-<runID>.<pprof|trace>
+func (c *pprofCollector) Collect(ctx context.Context, runID string, outputDir string) runs.ExecutionRun {
+	u := c.target.BaseURL
+	u.Path = path.Join(pprofBasePath, string(c.profile))
+	u.RawQuery = profileQuery(c.profile, c.seconds)
+
+	maxBytes := int64(0)
+	if c.profile == TraceProfile {
+		maxBytes = c.target.TraceMaxBytes
+	}
+
+	clog.Infof("requesting %s %s profiling, runID: %s", c.target.Name, c.profile, runID)
+	run := sendHTTPProfileRequest(ctx, c.Type(), "GET", u.String(), c.target.Token, PprofOutputFilePath(outputDir, c.target.Name, runID, c.profile), maxBytes, c.target.Client)
+	run.Target = c.target.Name
+	run.Profile = string(c.profile)
+	return run
+}
+
+// PprofOutputFilePath returns the full file path for a pprof output.
+// CPU profiles keep the historical <prefix>-<id>.pprof name, execution traces
+// are saved as <prefix>-<id>.trace and other profile types as <prefix>-<profile>-<id>.pprof.
+func PprofOutputFilePath(outputDir, prefix, id string, profile ProfileType) string {
+	switch profile {
+	case CPUProfile:
+		return filepath.Join(outputDir, prefix+"-"+id+"."+pprofFileExt)
+	case TraceProfile:
+		return filepath.Join(outputDir, prefix+"-"+id+"."+traceFileExt)
+	}
+	return filepath.Join(outputDir, prefix+"-"+string(profile)+"-"+id+"."+pprofFileExt)
+}
+
+// profileQuery returns the query sent to the pprof endpoint of the given profile type:
+// only CPU profiles and execution traces are sampled over a duration, the other types are snapshots.
+func profileQuery(profile ProfileType, seconds int) string {
+	if profile != CPUProfile && profile != TraceProfile {
+		return ""
+	}
+	return url.Values{"seconds": []string{strconv.Itoa(seconds)}}.Encode()
+}
+
+// profileRunType returns the type of the run collecting the given profile type from a target.
+func profileRunType(targetRunType runs.RunType, profile ProfileType) runs.RunType {
+	if profile == TraceProfile {
+		return runs.TraceRun
+	}
+	return targetRunType
+}
+
+// sendHTTPProfileRequest sends the http request to the given url,
+// writes the response down to the given output and returns the profiling run instance.
+// Responses larger than maxBytes are discarded, unless maxBytes is 0.
+func sendHTTPProfileRequest(ctx context.Context, rtype runs.RunType, method, url, token, outputPath string, maxBytes int64, client *http.Client) runs.ExecutionRun {
+	run := runs.ExecutionRun{
+		Type:      rtype,
+		BeginTime: time.Now(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("failed to create http request: %v", err)
+		return run
+	}
+
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("failed sending profiling request: %v", err)
+		return run
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("error status code received: %d", res.StatusCode)
+		return run
+	}
+
+	if maxBytes > 0 && res.ContentLength > maxBytes {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("profiling data of %d bytes exceeds the limit of %d bytes", res.ContentLength, maxBytes)
+		return run
+	}
+
+	if err := writeToFile(res.Body, outputPath, maxBytes); err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("failed writing profiling data into file: %v", err)
+		return run
+	}
+
+	run.EndTime = time.Now()
+	run.Successful = true
+
+	return run
+}
+
+// writeToFile writes the contents of the reader into the given file.
+// If maxBytes is not 0 and the reader holds more than maxBytes, the file is removed
+// and an error is returned.
+func writeToFile(reader io.ReadCloser, filePath string, maxBytes int64) error {
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filePath, err)
+	}
+	defer out.Close()
+
+	if maxBytes <= 0 {
+		if _, err := io.Copy(out, reader); err != nil {
+			return fmt.Errorf("failed to write to file %s: %w", filePath, err)
+		}
+		return nil
+	}
+
+	// read one more byte than allowed to detect oversized contents
+	written, err := io.Copy(out, io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to write to file %s: %w", filePath, err)
+	}
+	if written > maxBytes {
+		if err := os.Remove(filePath); err != nil {
+			clog.Errorf("failed to remove oversized file %s: %v", filePath, err)
+		}
+		return fmt.Errorf("contents of file %s exceed the limit of %d bytes", filePath, maxBytes)
+	}
+	return nil
+}
+
+type httpTransportBuilder struct {
+	tlsClientConfig *tls.Config
+	dialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func newDefaultHTTPTransport() *httpTransportBuilder {
+	return &httpTransportBuilder{
+		dialContext: (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	}
+}
+
+func (b *httpTransportBuilder) tlsConfig() *tls.Config {
+	if b.tlsClientConfig == nil {
+		b.tlsClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return b.tlsClientConfig
+}
+
+func (b *httpTransportBuilder) withRootCAs(certs *x509.CertPool) *httpTransportBuilder {
+	b.tlsConfig().RootCAs = certs
+	return b
+}
+
+func (b *httpTransportBuilder) withClientCert(cert tls.Certificate) *httpTransportBuilder {
+	b.tlsConfig().Certificates = []tls.Certificate{cert}
+	return b
+}
+
+func (b *httpTransportBuilder) withServerName(name string) *httpTransportBuilder {
+	b.tlsConfig().ServerName = name
+	return b
+}
+
+func (b *httpTransportBuilder) withUnixDialContext(socket string) *httpTransportBuilder {
+	b.dialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext(ctx, "unix", socket)
+	}
+	return b
+}
+
+func (b *httpTransportBuilder) build() *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           b.dialContext,
+		TLSClientConfig:       b.tlsClientConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
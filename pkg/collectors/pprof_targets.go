@@ -0,0 +1,164 @@
+package collectors
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// targetNameRegexp restricts target names to what can safely be used in file names and URLs
+var targetNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// PprofTargetsConfig is the contents of the file declaring the extra pprof targets
+type PprofTargetsConfig struct {
+	Targets []PprofTargetConfig
+}
+
+// PprofTargetConfig declares a Go program exposing the net/http/pprof endpoints
+type PprofTargetConfig struct {
+	// Name of the target, used in profiling requests and as prefix of the output files
+	Name string
+	// Address is the host:port on which the pprof endpoints are served.
+	// Exactly one of Address and UnixSocket must be set.
+	Address string
+	// UnixSocket is the path of the unix socket on which the pprof endpoints are served
+	UnixSocket string
+	// Scheme is either http (default) or https
+	Scheme string
+	// CACertFile is the file containing the CAs verifying the server certificate, defaults to the system CAs
+	CACertFile string
+	// ServerName overrides the name used to verify the server certificate
+	ServerName string
+	// TokenFile is the file containing the bearer token sent to the target
+	TokenFile string
+	// ClientCertFile and ClientKeyFile hold the client certificate presented to the target
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// LoadPprofTargets reads the pprof targets declared in the given JSON file
+func LoadPprofTargets(configFile string, traceMaxBytes int64) ([]*PprofTarget, error) {
+	/* #nosec G304 the configuration file is a parameter of the agent, mounted by the operator */
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	config := PprofTargetsConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode pprof targets from %s: %w", configFile, err)
+	}
+
+	targets := []*PprofTarget{}
+	for _, tc := range config.Targets {
+		target, err := tc.newTarget(traceMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pprof target %q in %s: %w", tc.Name, configFile, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// newTarget validates the configuration and creates the corresponding pprof target
+func (tc PprofTargetConfig) newTarget(traceMaxBytes int64) (*PprofTarget, error) {
+	if !targetNameRegexp.MatchString(tc.Name) {
+		return nil, fmt.Errorf("name must consist of lower case alphanumeric characters or '-'")
+	}
+	if (tc.Address == "") == (tc.UnixSocket == "") {
+		return nil, fmt.Errorf("exactly one of Address and UnixSocket must be set")
+	}
+
+	scheme := tc.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", scheme)
+	}
+	if scheme == "http" && (tc.CACertFile != "" || tc.ClientCertFile != "" || tc.ServerName != "") {
+		return nil, fmt.Errorf("TLS settings require the https scheme")
+	}
+	if (tc.ClientCertFile == "") != (tc.ClientKeyFile == "") {
+		return nil, fmt.Errorf("ClientCertFile and ClientKeyFile must be set together")
+	}
+
+	transport := newDefaultHTTPTransport()
+	host := tc.Address
+	if tc.UnixSocket != "" {
+		transport = transport.withUnixDialContext(tc.UnixSocket)
+		// the host is only used in the request line and for TLS verification
+		host = "localhost"
+	} else if _, _, err := net.SplitHostPort(tc.Address); err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	if scheme == "https" {
+		if tc.CACertFile != "" {
+			caCerts, err := readCACertFile(tc.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			transport = transport.withRootCAs(caCerts)
+		}
+		if tc.ClientCertFile != "" {
+			cert, err := tls.LoadX509KeyPair(tc.ClientCertFile, tc.ClientKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load client certificate: %w", err)
+			}
+			transport = transport.withClientCert(cert)
+		}
+		if tc.ServerName != "" {
+			transport = transport.withServerName(tc.ServerName)
+		}
+	}
+
+	token := ""
+	if tc.TokenFile != "" {
+		/* #nosec G304 the token file is declared in the configuration file of the agent */
+		content, err := os.ReadFile(tc.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		// token files usually end with a newline, which isn't valid in a header
+		token = strings.TrimSpace(string(content))
+		if token == "" {
+			return nil, fmt.Errorf("%s was empty", tc.TokenFile)
+		}
+	}
+
+	return &PprofTarget{
+		Name:    tc.Name,
+		RunType: runs.PprofRun,
+		BaseURL: url.URL{
+			Scheme: scheme,
+			Host:   host,
+		},
+		Token: token,
+		Client: &http.Client{
+			Transport: transport.build(),
+		},
+		TraceMaxBytes: traceMaxBytes,
+	}, nil
+}
+
+func readCACertFile(caCertFile string) (*x509.CertPool, error) {
+	/* #nosec G304 the CA file is declared in the configuration file of the agent */
+	content, err := os.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("unable to add certificates from %s into the CA pool", caCertFile)
+	}
+	return caCertPool, nil
+}
@@ -0,0 +1,171 @@
+package collectors
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+func TestLoadPprofTargets(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	emptyTokenFile := filepath.Join(dir, "emptyToken")
+	if err := os.WriteFile(emptyTokenFile, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	blankTokenFile := filepath.Join(dir, "blankToken")
+	if err := os.WriteFile(blankTokenFile, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caCertFile := "../../test_resources/kubelet-serving-ca.crt"
+
+	testCases := []struct {
+		name          string
+		config        string
+		expectedURL   string
+		expectedToken string
+		expectedError bool
+	}{
+		{
+			name:        "TCP target without TLS",
+			config:      `{"Targets":[{"Name":"kube-proxy","Address":"127.0.0.1:10249"}]}`,
+			expectedURL: "http://127.0.0.1:10249",
+		},
+		{
+			name:          "TCP target with TLS and token",
+			config:        `{"Targets":[{"Name":"etcd","Address":"10.0.0.1:2379","Scheme":"https","CACertFile":"` + caCertFile + `","TokenFile":"` + tokenFile + `"}]}`,
+			expectedURL:   "https://10.0.0.1:2379",
+			expectedToken: "abc",
+		},
+		{
+			name:        "Unix socket target",
+			config:      `{"Targets":[{"Name":"ovnkube","UnixSocket":"/var/run/ovnkube.sock"}]}`,
+			expectedURL: "http://localhost",
+		},
+		{
+			name:          "Invalid name, error",
+			config:        `{"Targets":[{"Name":"../etcd","Address":"127.0.0.1:2379"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Both address and unix socket, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","UnixSocket":"/var/run/etcd.sock"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Neither address nor unix socket, error",
+			config:        `{"Targets":[{"Name":"etcd"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Address without port, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Unknown scheme, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","Scheme":"ftp"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "CA file without TLS, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","CACertFile":"` + caCertFile + `"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Client certificate without key, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","Scheme":"https","ClientCertFile":"` + caCertFile + `"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Empty token file, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","TokenFile":"` + emptyTokenFile + `"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Blank token file, error",
+			config:        `{"Targets":[{"Name":"etcd","Address":"127.0.0.1:2379","TokenFile":"` + blankTokenFile + `"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Invalid JSON, error",
+			config:        `{"Targets":[{"Name":"etcd"`,
+			expectedError: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile := filepath.Join(dir, "targets"+string(rune('a'+i))+".json")
+			if err := os.WriteFile(configFile, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			targets, err := LoadPprofTargets(configFile, 10)
+			if tc.expectedError {
+				if err == nil {
+					t.Error("Expected error but didnt get any")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect error but got %v", err)
+			}
+			if len(targets) != 1 {
+				t.Fatalf("Expected 1 target but got %d", len(targets))
+			}
+			if targets[0].RunType != runs.PprofRun {
+				t.Errorf("Expected run type %q but got %q", runs.PprofRun, targets[0].RunType)
+			}
+			if got := targets[0].BaseURL.String(); tc.expectedURL != got {
+				t.Errorf("Expected URL %q but got %q", tc.expectedURL, got)
+			}
+			if tc.expectedToken != targets[0].Token {
+				t.Errorf("Expected token %q but got %q", tc.expectedToken, targets[0].Token)
+			}
+			if targets[0].TraceMaxBytes != 10 {
+				t.Errorf("Expected trace limit of 10 bytes but got %d", targets[0].TraceMaxBytes)
+			}
+		})
+	}
+}
+
+func TestUnixSocketPprofTarget(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "pprof.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("heap"))
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Close()
+
+	target, err := PprofTargetConfig{Name: "daemon", UnixSocket: socket}.newTarget(0)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	cs := target.Factory()(Params{Profiles: map[string][]ProfileType{"daemon": {HeapProfile}}})
+	if len(cs) != 1 {
+		t.Fatalf("Expected 1 collector but got %d", len(cs))
+	}
+	run := cs[0].Collect(context.Background(), "fakeid", dir)
+	if !run.Successful {
+		t.Fatalf("Expecting collection to succeed but got %q", run.Error)
+	}
+	if contents, err := os.ReadFile(filepath.Join(dir, "daemon-heap-fakeid.pprof")); err != nil || string(contents) != "heap" {
+		t.Errorf("Expecting heap profile to be saved, got %q: %v", contents, err)
+	}
+}
@@ -0,0 +1,277 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+const (
+	fakeMethod     = "get"
+	fakeURL        = "http://fakehost:8080/debug"
+	fakeToken      = ""
+	fakeOutputFile = "fakefile"
+)
+
+func TestSendHTTPProfileRequest(t *testing.T) {
+	testCases := []struct {
+		name             string
+		client           *http.Client
+		maxBytes         int64
+		expectedRun      runs.ExecutionRun
+		expectedContents string
+	}{
+		{
+			name: "Nominal",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("OK", nil, http.StatusOK), nil
+			}),
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.KubeletRun,
+				Successful: true,
+				Error:      "",
+			},
+			expectedContents: "OK",
+		},
+		{
+			name: "HTTP query error",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("", nil, http.StatusUnauthorized), fmt.Errorf("fake error")
+			}),
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.KubeletRun,
+				Successful: false,
+				Error:      fmt.Sprintf("failed sending profiling request: %s %q: fake error", cases.Title(language.Und).String(fakeMethod), fakeURL),
+			},
+		},
+		{
+			name: "HTTP response status not OK",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("", nil, http.StatusUnauthorized), nil
+			}),
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.KubeletRun,
+				Successful: false,
+				Error:      "error status code received: 401",
+			},
+		},
+		{
+			name: "Write to file failed",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("OK", fmt.Errorf("fake error"), http.StatusOK), nil
+			}),
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.KubeletRun,
+				Successful: false,
+				Error:      fmt.Sprintf("failed writing profiling data into file: failed to write to file .+/%s: fake error", fakeOutputFile),
+			},
+		},
+		{
+			name: "Response within the size limit",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("OK", nil, http.StatusOK), nil
+			}),
+			maxBytes: 2,
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.TraceRun,
+				Successful: true,
+				Error:      "",
+			},
+			expectedContents: "OK",
+		},
+		{
+			name: "Response exceeds the size limit",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				return newTestResponse("too big", nil, http.StatusOK), nil
+			}),
+			maxBytes: 2,
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.TraceRun,
+				Successful: false,
+				Error:      fmt.Sprintf("failed writing profiling data into file: contents of file .+/%s exceed the limit of 2 bytes", fakeOutputFile),
+			},
+		},
+		{
+			name: "Response announces a size above the limit",
+			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+				res := newTestResponse("too big", nil, http.StatusOK)
+				res.ContentLength = 7
+				return res, nil
+			}),
+			maxBytes: 2,
+			expectedRun: runs.ExecutionRun{
+				Type:       runs.TraceRun,
+				Successful: false,
+				Error:      "profiling data of 7 bytes exceeds the limit of 2 bytes",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			pr := sendHTTPProfileRequest(context.Background(), runs.UnknownRun, strings.ToUpper(fakeMethod), fakeURL, fakeToken, dir+"/"+fakeOutputFile, tc.maxBytes, tc.client)
+			if tc.expectedRun.Successful != pr.Successful {
+				t.Errorf("Expecting ProfilingRun successful to be %t but got %t", tc.expectedRun.Successful, pr.Successful)
+			}
+			if matched, err := regexp.Match(tc.expectedRun.Error, []byte(pr.Error)); err != nil {
+				t.Errorf("Failed to match ProfilingRun error: %v", err)
+			} else if !matched {
+				t.Errorf("Expecting ProfilingRun error %q to match %q regexp", pr.Error, tc.expectedRun.Error)
+			}
+			if pr.BeginTime.After(pr.EndTime) {
+				t.Errorf("Expecting begin time %v to be before the end time %v", pr.BeginTime, pr.EndTime)
+			}
+			if !tc.expectedRun.Successful && tc.maxBytes > 0 {
+				if _, err := os.Stat(dir + "/" + fakeOutputFile); err == nil {
+					t.Errorf("Expecting oversized profiling data to be removed")
+				}
+			}
+			if tc.expectedContents != "" {
+				if contents, err := os.ReadFile(dir + "/" + fakeOutputFile); err != nil {
+					t.Errorf("Failed to read the contents of kubelet pprof data: %v", err)
+				} else {
+					if tc.expectedContents != string(contents) {
+						t.Errorf("Expecting pprof contents: %q, but got %q", tc.expectedContents, string(contents))
+					}
+				}
+			}
+		})
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type testReadCloser struct {
+	*bytes.Reader
+	err error
+}
+
+func (r *testReadCloser) WriteTo(w io.Writer) (int64, error) {
+	// writeToFile uses io.Copy which in turn uses WriteTo method if it's present.
+	// Since we embed bytes.Reader, WriteTo is the one to be hooked up.
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.Reader.WriteTo(w)
+}
+
+func (r *testReadCloser) Close() error {
+	return nil
+}
+
+func newHTTPTestClient(fn roundTripFunc) *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(fn),
+	}
+}
+
+func newTestResponse(body string, err error, statusCode int) *http.Response {
+	return &http.Response{
+		Body: &testReadCloser{
+			Reader: bytes.NewReader([]byte(body)),
+			err:    err,
+		},
+		StatusCode: statusCode,
+		Header:     make(http.Header),
+	}
+}
+
+func TestProfileQuery(t *testing.T) {
+	if expected, got := "seconds=120", profileQuery(CPUProfile, 120); expected != got {
+		t.Errorf("Wrong CPU profile query, expected: %q, but got: %q", expected, got)
+	}
+	if expected, got := "seconds=10", profileQuery(TraceProfile, 10); expected != got {
+		t.Errorf("Wrong trace query, expected: %q, but got: %q", expected, got)
+	}
+	if expected, got := "", profileQuery(HeapProfile, 120); expected != got {
+		t.Errorf("Wrong heap profile query, expected: %q, but got: %q", expected, got)
+	}
+}
+
+func TestProfileRunType(t *testing.T) {
+	if expected, got := runs.KubeletRun, profileRunType(runs.KubeletRun, HeapProfile); expected != got {
+		t.Errorf("Wrong run type for kubelet heap profile, expected: %q, but got: %q", expected, got)
+	}
+	if expected, got := runs.TraceRun, profileRunType(runs.CrioRun, TraceProfile); expected != got {
+		t.Errorf("Wrong run type for CRIO trace, expected: %q, but got: %q", expected, got)
+	}
+}
+
+func TestPprofOutputFilePath(t *testing.T) {
+	if expected, got := "/fakedir/crio-fakeid.pprof", PprofOutputFilePath("/fakedir", CrioTarget, "fakeid", CPUProfile); expected != got {
+		t.Errorf("Wrong crio output path, expected: %q, but got: %q", expected, got)
+	}
+
+	if expected, got := "/fakedir/kubelet-fakeid.pprof", PprofOutputFilePath("/fakedir", KubeletTarget, "fakeid", CPUProfile); expected != got {
+		t.Errorf("Wrong kubelet output path, expected: %q, but got: %q", expected, got)
+	}
+
+	if expected, got := "/fakedir/kubelet-heap-fakeid.pprof", PprofOutputFilePath("/fakedir", KubeletTarget, "fakeid", HeapProfile); expected != got {
+		t.Errorf("Wrong kubelet heap output path, expected: %q, but got: %q", expected, got)
+	}
+
+	if expected, got := "/fakedir/crio-fakeid.trace", PprofOutputFilePath("/fakedir", CrioTarget, "fakeid", TraceProfile); expected != got {
+		t.Errorf("Wrong crio trace output path, expected: %q, but got: %q", expected, got)
+	}
+}
+
+func TestPprofCollector(t *testing.T) {
+	var requestedURL string
+	target := &PprofTarget{
+		Name:    "fake",
+		RunType: runs.KubeletRun,
+		BaseURL: url.URL{Scheme: "https", Host: "fakehost:8080"},
+		Client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
+			requestedURL = req.URL.String()
+			return newTestResponse("OK", nil, http.StatusOK), nil
+		}),
+	}
+	cs := target.Factory()(Params{
+		Profiles: map[string][]ProfileType{
+			"fake":  {CPUProfile, TraceProfile},
+			"other": {HeapProfile},
+		},
+		Seconds: 5,
+	})
+	if len(cs) != 2 {
+		t.Fatalf("Expecting 2 collectors but got %d", len(cs))
+	}
+	if expected, got := "fake/trace", cs[1].Name(); expected != got {
+		t.Errorf("Wrong collector name, expected: %q, but got: %q", expected, got)
+	}
+	if expected, got := runs.TraceRun, cs[1].Type(); expected != got {
+		t.Errorf("Wrong collector type, expected: %q, but got: %q", expected, got)
+	}
+
+	dir := t.TempDir()
+	run := cs[0].Collect(context.Background(), "fakeid", dir)
+	if !run.Successful {
+		t.Errorf("Expecting collection to succeed but got %q", run.Error)
+	}
+	if run.Target != "fake" || run.Profile != string(CPUProfile) || run.Type != runs.KubeletRun {
+		t.Errorf("Wrong execution run, got target %q, profile %q, type %q", run.Target, run.Profile, run.Type)
+	}
+	if expected := "https://fakehost:8080/debug/pprof/profile?seconds=5"; expected != requestedURL {
+		t.Errorf("Wrong requested URL, expected: %q, but got: %q", expected, requestedURL)
+	}
+	if _, err := os.Stat(dir + "/fake-fakeid.pprof"); err != nil {
+		t.Errorf("Expecting profile to be saved: %v", err)
+	}
+}
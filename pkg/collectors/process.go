@@ -0,0 +1,159 @@
+package collectors
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// ProcessSampler is the name of the sampler of the kubelet and CRIO processes
+const ProcessSampler = "processes"
+
+// hyperkube is the command running kubelet as its first argument on older nodes
+const hyperkube = "hyperkube"
+
+// trackedTargets are the pprof targets whose processes are sampled, their process name is the name of the target
+var trackedTargets = []string{KubeletTarget, CrioTarget}
+
+// TrackedSample holds the resource usage of the kubelet and CRIO processes at a point in time
+type TrackedSample struct {
+	Time      time.Time
+	Processes []TrackedProcess
+	// Errors lists the processes which weren't found, and the statistics which couldn't be read
+	Errors []string
+}
+
+// TrackedProcess holds the resource usage of the process of a target
+type TrackedProcess struct {
+	Target  string
+	Cmdline []string
+	ProcessSample
+	// FDs is the number of open file descriptors
+	FDs int
+	// SmapsRollup is the memory of all the mappings of the process, in bytes
+	SmapsRollup map[string]uint64
+}
+
+// NewProcessSamplerFactory returns the factory of the sampler of the kubelet and CRIO processes, reading the given procfs.
+// The sampler tracks both processes during the whole run if ProcessSampler is part of the samplers of the run.
+// Otherwise, it tracks the processes of the profiled targets during their CPU profiles and execution traces,
+// or takes a single sample if none is requested.
+func NewProcessSamplerFactory(proc procfs.FS) Factory {
+	return func(params Params) []Collector {
+		targets, window := trackedProcesses(params)
+		if len(targets) == 0 {
+			return nil
+		}
+		return []Collector{&sampler{
+			name:       ProcessSampler,
+			runType:    runs.ProcessRun,
+			resolution: params.resolution(),
+			duration:   window,
+			sample: func() interface{} {
+				return sampleTrackedProcesses(proc, targets)
+			},
+		}}
+	}
+}
+
+// trackedProcesses returns the targets whose processes are sampled during the run, and for how long
+func trackedProcesses(params Params) ([]string, time.Duration) {
+	seconds := time.Duration(params.Seconds) * time.Second
+	if params.HasSampler(ProcessSampler) {
+		return trackedTargets, seconds
+	}
+	targets := []string{}
+	var window time.Duration
+	for _, target := range trackedTargets {
+		profiles, ok := params.Profiles[target]
+		if !ok {
+			continue
+		}
+		targets = append(targets, target)
+		for _, p := range profiles {
+			if p == CPUProfile || p == TraceProfile {
+				window = seconds
+			}
+		}
+	}
+	return targets, window
+}
+
+// sampleTrackedProcesses locates the processes of the targets, they are looked
+// up at each sample so that restarted processes keep being tracked
+func sampleTrackedProcesses(proc procfs.FS, targets []string) TrackedSample {
+	s := TrackedSample{Time: time.Now()}
+	pids, err := findProcesses(proc, targets)
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+		return s
+	}
+	for _, target := range targets {
+		if len(pids[target]) == 0 {
+			s.Errors = append(s.Errors, fmt.Sprintf("no %s process found", target))
+		}
+		for _, pid := range pids[target] {
+			p, errs := sampleTrackedProcess(proc, target, pid)
+			s.Errors = append(s.Errors, errs...)
+			if p != nil {
+				s.Processes = append(s.Processes, *p)
+			}
+		}
+	}
+	return s
+}
+
+// sampleTrackedProcess reads the resource usage of a process, it returns nil if the process exited
+func sampleTrackedProcess(proc procfs.FS, target string, pid int) (*TrackedProcess, []string) {
+	sample, err := sampleProcess(proc, pid)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	p := &TrackedProcess{Target: target, ProcessSample: sample}
+	var errs []string
+	if p.Cmdline, err = proc.ProcCmdline(pid); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if p.FDs, err = proc.ProcFDs(pid); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if p.SmapsRollup, err = proc.ProcSmapsRollup(pid); err != nil {
+		errs = append(errs, err.Error())
+	}
+	return p, errs
+}
+
+// findProcesses returns the pids of the processes of the targets, matched by command name,
+// or by command line for kubelet run by hyperkube
+func findProcesses(proc procfs.FS, targets []string) (map[string][]int, error) {
+	pids, err := proc.PIDs()
+	if err != nil {
+		return nil, err
+	}
+	found := map[string][]int{}
+	for _, pid := range pids {
+		stat, err := proc.ProcStat(pid)
+		if err != nil {
+			// the process exited
+			continue
+		}
+		for _, target := range targets {
+			if stat.Comm == target || (stat.Comm == hyperkube && runsTarget(proc, pid, target)) {
+				found[target] = append(found[target], pid)
+			}
+		}
+	}
+	return found, nil
+}
+
+// runsTarget returns true if the command line of the process runs the target as a subcommand: hyperkube kubelet
+func runsTarget(proc procfs.FS, pid int, target string) bool {
+	cmdline, err := proc.ProcCmdline(pid)
+	if err != nil || len(cmdline) < 2 {
+		return false
+	}
+	return filepath.Base(cmdline[0]) == hyperkube && cmdline[1] == target
+}
@@ -0,0 +1,136 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+func TestTrackedProcesses(t *testing.T) {
+	testCases := []struct {
+		name            string
+		params          Params
+		expectedTargets []string
+		expectedWindow  time.Duration
+	}{
+		{
+			name:            "CPU profiles of kubelet and CRIO",
+			params:          Params{Seconds: 30, Profiles: map[string][]ProfileType{KubeletTarget: {CPUProfile}, CrioTarget: {CPUProfile}}},
+			expectedTargets: []string{KubeletTarget, CrioTarget},
+			expectedWindow:  30 * time.Second,
+		},
+		{
+			name:            "Execution trace of CRIO",
+			params:          Params{Seconds: 10, Profiles: map[string][]ProfileType{CrioTarget: {HeapProfile, TraceProfile}}},
+			expectedTargets: []string{CrioTarget},
+			expectedWindow:  10 * time.Second,
+		},
+		{
+			name:            "Heap profile of kubelet, single sample",
+			params:          Params{Seconds: 30, Profiles: map[string][]ProfileType{KubeletTarget: {HeapProfile}}},
+			expectedTargets: []string{KubeletTarget},
+		},
+		{
+			name:            "Process sampler requested",
+			params:          Params{Seconds: 60, Samplers: []string{ProcessSampler}},
+			expectedTargets: []string{KubeletTarget, CrioTarget},
+			expectedWindow:  60 * time.Second,
+		},
+		{
+			name:            "Other targets and samplers only",
+			params:          Params{Seconds: 60, Samplers: []string{SystemSampler}, Profiles: map[string][]ProfileType{"etcd": {CPUProfile}}},
+			expectedTargets: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targets, window := trackedProcesses(tc.params)
+			if !reflect.DeepEqual(tc.expectedTargets, targets) {
+				t.Errorf("expected targets %v but got %v", tc.expectedTargets, targets)
+			}
+			if tc.expectedWindow != window {
+				t.Errorf("expected window %s but got %s", tc.expectedWindow, window)
+			}
+		})
+	}
+}
+
+func TestProcessSamplerFactory(t *testing.T) {
+	factory := NewProcessSamplerFactory(procfs.NewFS(testProcRoot))
+	if cs := factory(Params{Seconds: 1, Samplers: []string{SystemSampler}}); len(cs) != 0 {
+		t.Errorf("expected no collector when kubelet and CRIO aren't profiled but got %d", len(cs))
+	}
+	cs := factory(Params{Seconds: 1, Profiles: map[string][]ProfileType{KubeletTarget: {CPUProfile}}})
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 collector but got %d", len(cs))
+	}
+	if cs[0].Name() != ProcessSampler || cs[0].Type() != runs.ProcessRun {
+		t.Errorf("unexpected collector %s of type %s", cs[0].Name(), cs[0].Type())
+	}
+}
+
+func TestSampleTrackedProcesses(t *testing.T) {
+	s := sampleTrackedProcesses(procfs.NewFS(testProcRoot), trackedTargets)
+	if len(s.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", s.Errors)
+	}
+	if len(s.Processes) != 2 {
+		t.Fatalf("expected kubelet and CRIO processes but got %+v", s.Processes)
+	}
+	kubelet, crio := s.Processes[0], s.Processes[1]
+	if kubelet.Target != KubeletTarget || kubelet.Stat.PID != 2104 || kubelet.FDs != 12 || kubelet.Status.Threads != 52 {
+		t.Errorf("unexpected kubelet process %+v", kubelet)
+	}
+	if kubelet.SmapsRollup["AnonHugePages"] != 96256*1024 || kubelet.Cmdline[0] != "/usr/bin/kubelet" {
+		t.Errorf("unexpected kubelet process %+v", kubelet)
+	}
+	if crio.Target != CrioTarget || crio.Stat.PID != 1520 || crio.FDs != 8 || crio.Stat.UTime != 42000 {
+		t.Errorf("unexpected CRIO process %+v", crio)
+	}
+}
+
+func TestFindProcesses(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		// kubelet run by hyperkube, and a process named like a subcommand
+		"10/stat":    "10 (hyperkube) S 1 10 10 0 -1 0 0 0 0 0 5 6 0 0 20 0 1 0 10 1000 10\n",
+		"10/cmdline": "/usr/bin/hyperkube\x00kubelet\x00--config=/etc/kubernetes/kubelet.conf\x00",
+		"10/status":  "Name:\thyperkube\nThreads:\t20\n",
+		"11/stat":    "11 (hyperkube) S 1 11 11 0 -1 0 0 0 0 0 5 6 0 0 20 0 1 0 10 1000 10\n",
+		"11/cmdline": "/usr/bin/hyperkube\x00kube-proxy\x00",
+		"12/stat":    "12 (crio-wipe) S 1 12 12 0 -1 0 0 0 0 0 5 6 0 0 20 0 1 0 10 1000 10\n",
+		"12/cmdline": "/usr/bin/crio\x00wipe\x00",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proc := procfs.NewFS(root)
+
+	found, err := findProcesses(proc, trackedTargets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string][]int{KubeletTarget: {10}}; !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected processes %v but got %v", expected, found)
+	}
+
+	s := sampleTrackedProcesses(proc, trackedTargets)
+	if len(s.Processes) != 1 {
+		t.Errorf("expected the kubelet process only but got %+v", s.Processes)
+	}
+	// crio is missing, and the fd and smaps_rollup of kubelet as well
+	if len(s.Errors) != 3 {
+		t.Errorf("expected 3 errors but got %v", s.Errors)
+	}
+}
@@ -0,0 +1,69 @@
+package collectors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/node-observability-agent/pkg/cgroupfs"
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+)
+
+// DefaultSysRoot is the mount point of sysfs
+const DefaultSysRoot = "/sys"
+
+// Roots holds the mount points of the host filesystems read by the native collectors.
+// The agent running in a container sees the ones of the host through mounts such as /host/proc
+// and /host/sys. The empty roots are the ones of the agent.
+type Roots struct {
+	Proc string
+	Sys  string
+	// Cgroup is the mount point of the cgroup v2 hierarchy, <Sys>/fs/cgroup if empty
+	Cgroup string
+}
+
+// ProcFS returns the procfs read by the collectors
+func (r Roots) ProcFS() procfs.FS {
+	if r.Proc == "" {
+		return procfs.NewFS(procfs.DefaultRoot)
+	}
+	return procfs.NewFS(r.Proc)
+}
+
+// SysRoot returns the mount point of sysfs
+func (r Roots) SysRoot() string {
+	if r.Sys == "" {
+		return DefaultSysRoot
+	}
+	return r.Sys
+}
+
+// CgroupRoot returns the mount point of the cgroup v2 hierarchy
+func (r Roots) CgroupRoot() string {
+	if r.Cgroup == "" {
+		return filepath.Join(r.SysRoot(), "fs", "cgroup")
+	}
+	return r.Cgroup
+}
+
+// CgroupFS returns the cgroup v2 hierarchy read by the collectors
+func (r Roots) CgroupFS() cgroupfs.FS {
+	return cgroupfs.NewFS(r.CgroupRoot())
+}
+
+// Check returns an error if the roots aren't directories, or if the proc root isn't a procfs
+func (r Roots) Check() error {
+	for _, root := range []string{r.ProcFS().Root(), r.SysRoot(), r.CgroupRoot()} {
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", root)
+		}
+	}
+	if _, err := os.Stat(r.ProcFS().Path("stat")); err != nil {
+		return fmt.Errorf("%s is not a procfs: %w", r.ProcFS().Root(), err)
+	}
+	return nil
+}
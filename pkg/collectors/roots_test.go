@@ -0,0 +1,90 @@
+package collectors
+
+import (
+	"testing"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+)
+
+func TestRoots(t *testing.T) {
+	testCases := []struct {
+		name           string
+		roots          Roots
+		expectedProc   string
+		expectedSys    string
+		expectedCgroup string
+	}{
+		{
+			name:           "Default roots",
+			expectedProc:   procfs.DefaultRoot,
+			expectedSys:    DefaultSysRoot,
+			expectedCgroup: "/sys/fs/cgroup",
+		},
+		{
+			name:           "Host mounts",
+			roots:          Roots{Proc: "/host/proc", Sys: "/host/sys"},
+			expectedProc:   "/host/proc",
+			expectedSys:    "/host/sys",
+			expectedCgroup: "/host/sys/fs/cgroup",
+		},
+		{
+			name:           "Cgroup hierarchy mounted elsewhere",
+			roots:          Roots{Proc: "/host/proc", Sys: "/host/sys", Cgroup: "/host/cgroup"},
+			expectedProc:   "/host/proc",
+			expectedSys:    "/host/sys",
+			expectedCgroup: "/host/cgroup",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if proc := tc.roots.ProcFS().Root(); proc != tc.expectedProc {
+				t.Errorf("expected proc root %s but got %s", tc.expectedProc, proc)
+			}
+			if sys := tc.roots.SysRoot(); sys != tc.expectedSys {
+				t.Errorf("expected sys root %s but got %s", tc.expectedSys, sys)
+			}
+			if cgroup := tc.roots.CgroupRoot(); cgroup != tc.expectedCgroup {
+				t.Errorf("expected cgroup root %s but got %s", tc.expectedCgroup, cgroup)
+			}
+		})
+	}
+}
+
+func TestRootsCheck(t *testing.T) {
+	testCases := []struct {
+		name          string
+		roots         Roots
+		expectedError bool
+	}{
+		{
+			name:  "Fixture tree",
+			roots: Roots{Proc: testProcRoot, Sys: t.TempDir(), Cgroup: t.TempDir()},
+		},
+		{
+			name:          "Missing proc root",
+			roots:         Roots{Proc: "/nonexistent/proc", Sys: t.TempDir(), Cgroup: t.TempDir()},
+			expectedError: true,
+		},
+		{
+			name:          "Proc root is not a procfs",
+			roots:         Roots{Proc: t.TempDir(), Sys: t.TempDir(), Cgroup: t.TempDir()},
+			expectedError: true,
+		},
+		{
+			name:          "Missing cgroup root",
+			roots:         Roots{Proc: testProcRoot, Sys: t.TempDir()},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.roots.Check()
+			if tc.expectedError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+const (
+	// SystemSampler is the name of the sampler of the system and process statistics
+	SystemSampler = "system"
+	// DefaultResolution is the interval between two samples when the request doesn't set one
+	DefaultResolution = 5 * time.Second
+	samplesFileExt    = "jsonl"
+)
+
+// SystemSample holds the system statistics, and the statistics of every process, at a point in time.
+// Counters are the raw values of procfs, cumulated since boot or since the start of the processes.
+type SystemSample struct {
+	Time       time.Time
+	Stat       procfs.Stat
+	Meminfo    map[string]uint64
+	Softirqs   map[string][]uint64
+	Interrupts []procfs.Interrupt
+	Diskstats  []procfs.DiskStats
+	Processes  []ProcessSample
+	// Errors lists the statistics which couldn't be read
+	Errors []string
+}
+
+// ProcessSample holds the statistics of a process, IO is nil if /proc/<pid>/io isn't readable
+type ProcessSample struct {
+	Stat   procfs.ProcStat
+	Status procfs.ProcStatus
+	IO     *procfs.ProcIO
+}
+
+// NewSystemSamplerFactory returns the factory of the system sampler reading the given procfs,
+// it builds the sampler if SystemSampler is part of the samplers of the run
+func NewSystemSamplerFactory(proc procfs.FS) Factory {
+	return func(params Params) []Collector {
+		if !params.HasSampler(SystemSampler) {
+			return nil
+		}
+		return []Collector{&sampler{
+			name:       SystemSampler,
+			runType:    runs.SystemRun,
+			resolution: params.resolution(),
+			duration:   time.Duration(params.Seconds) * time.Second,
+			sample: func() interface{} {
+				return sampleSystem(proc)
+			},
+		}}
+	}
+}
+
+// sampleSystem reads the system statistics and the statistics of every process
+func sampleSystem(proc procfs.FS) SystemSample {
+	s := SystemSample{Time: time.Now()}
+	var err error
+	if s.Stat, err = proc.Stat(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Meminfo, err = proc.Meminfo(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Softirqs, err = proc.Softirqs(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Interrupts, err = proc.Interrupts(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Diskstats, err = proc.Diskstats(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+
+	pids, err := proc.PIDs()
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	for _, pid := range pids {
+		p, err := sampleProcess(proc, pid)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the process exited
+			continue
+		}
+		if err != nil {
+			s.Errors = append(s.Errors, err.Error())
+			continue
+		}
+		s.Processes = append(s.Processes, p)
+	}
+	return s
+}
+
+// sampleProcess reads the statistics of the process of the given pid
+func sampleProcess(proc procfs.FS, pid int) (ProcessSample, error) {
+	var p ProcessSample
+	var err error
+	if p.Stat, err = proc.ProcStat(pid); err != nil {
+		return p, err
+	}
+	if p.Status, err = proc.ProcStatus(pid); err != nil {
+		return p, err
+	}
+	if io, err := proc.ProcIO(pid); err == nil {
+		p.IO = &io
+	}
+	return p, nil
+}
+
+// sampler writes a sample every resolution for duration, as a line of JSON
+type sampler struct {
+	name       string
+	runType    runs.RunType
+	resolution time.Duration
+	duration   time.Duration
+	sample     func() interface{}
+}
+
+// Name implements Collector.Name
+func (s *sampler) Name() string {
+	return s.name
+}
+
+// Type implements Collector.Type
+func (s *sampler) Type() runs.RunType {
+	return s.runType
+}
+
+// Collect implements Collector.Collect, it saves the samples as outputDir/<name>-<runID>.jsonl
+func (s *sampler) Collect(ctx context.Context, runID string, outputDir string) runs.ExecutionRun {
+	run := runs.ExecutionRun{
+		Type:      s.runType,
+		Target:    s.name,
+		BeginTime: time.Now(),
+	}
+	clog.Infof("sampling %s every %s for %s, runID: %s", s.name, s.resolution, s.duration, runID)
+	if err := s.writeSamples(ctx, SamplesFilePath(outputDir, s.name, runID)); err != nil {
+		run.EndTime = time.Now()
+		run.Error = err.Error()
+		return run
+	}
+	run.EndTime = time.Now()
+	run.Successful = true
+	return run
+}
+
+// writeSamples writes the samples into the given file, from the start to the end of the duration
+func (s *sampler) writeSamples(ctx context.Context, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+
+	ticker := time.NewTicker(s.resolution)
+	defer ticker.Stop()
+	samples := int(s.duration/s.resolution) + 1
+	for i := 1; ; i++ {
+		if err := encoder.Encode(s.sample()); err != nil {
+			return fmt.Errorf("failed writing %s sample: %w", s.name, err)
+		}
+		// the samples are written as they are taken, so that they are available during the run
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed writing %s sample: %w", s.name, err)
+		}
+		if i == samples {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%s sampling interrupted: %w", s.name, ctx.Err())
+		}
+	}
+}
+
+// SamplesFilePath returns the full file path of the samples of a sampler
+func SamplesFilePath(outputDir, name, id string) string {
+	return filepath.Join(outputDir, name+"-"+id+"."+samplesFileExt)
+}
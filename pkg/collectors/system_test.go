@@ -0,0 +1,102 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/procfs"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// testProcRoot is the procfs fixture of a node running systemd, crio and kubelet
+const testProcRoot = "../../test_resources/host/proc"
+
+func TestSystemSamplerFactory(t *testing.T) {
+	factory := NewSystemSamplerFactory(procfs.NewFS(testProcRoot))
+	if cs := factory(Params{Seconds: 1}); len(cs) != 0 {
+		t.Errorf("expected no collector when the sampler isn't requested but got %d", len(cs))
+	}
+	cs := factory(Params{Seconds: 1, Samplers: []string{SystemSampler}})
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 collector but got %d", len(cs))
+	}
+	if cs[0].Name() != SystemSampler || cs[0].Type() != runs.SystemRun {
+		t.Errorf("unexpected collector %s of type %s", cs[0].Name(), cs[0].Type())
+	}
+	if s := cs[0].(*sampler); s.resolution != DefaultResolution {
+		t.Errorf("expected default resolution %s but got %s", DefaultResolution, s.resolution)
+	}
+}
+
+func TestSystemSampler(t *testing.T) {
+	outputDir := t.TempDir()
+	c := NewSystemSamplerFactory(procfs.NewFS(testProcRoot))(Params{
+		Seconds:    1,
+		Samplers:   []string{SystemSampler},
+		Resolution: 500 * time.Millisecond,
+	})[0]
+
+	run := c.Collect(context.Background(), "abc", outputDir)
+	if !run.Successful || run.Error != "" {
+		t.Fatalf("expected successful run but got %+v", run)
+	}
+
+	f, err := os.Open(SamplesFilePath(outputDir, SystemSampler, "abc"))
+	if err != nil {
+		t.Fatalf("unable to open the samples: %v", err)
+	}
+	defer f.Close()
+	samples := []SystemSample{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var s SystemSample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatalf("invalid sample: %v", err)
+		}
+		samples = append(samples, s)
+	}
+	// one sample at the start, and one every resolution until the end
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples but got %d", len(samples))
+	}
+	s := samples[0]
+	if len(s.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", s.Errors)
+	}
+	if s.Stat.ContextSwitches != 9100000 || s.Meminfo["MemTotal"] != 16384000*1024 || len(s.Diskstats) != 2 {
+		t.Errorf("unexpected system statistics: %+v", s)
+	}
+	if len(s.Processes) != 3 {
+		t.Fatalf("expected 3 processes but got %+v", s.Processes)
+	}
+	// the io file is only readable for some processes
+	if p := s.Processes[0]; p.Status.Name != "systemd" || p.IO == nil || p.IO.ReadBytes != 310000000 {
+		t.Errorf("unexpected process %+v", p)
+	}
+	if p := s.Processes[2]; p.Stat.Comm != "kubelet" || p.Status.VmRSS != 184320*1024 || p.IO != nil {
+		t.Errorf("unexpected process %+v", p)
+	}
+}
+
+func TestSystemSamplerCancelled(t *testing.T) {
+	outputDir := t.TempDir()
+	c := NewSystemSamplerFactory(procfs.NewFS(testProcRoot))(Params{
+		Seconds:  60,
+		Samplers: []string{SystemSampler},
+	})[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	run := c.Collect(ctx, "abc", outputDir)
+	if run.Successful || run.Error == "" {
+		t.Errorf("expected failed run but got %+v", run)
+	}
+	if _, err := os.Stat(SamplesFilePath(outputDir, SystemSampler, "abc")); err != nil {
+		t.Errorf("expected the samples taken before the cancellation: %v", err)
+	}
+}
@@ -1,37 +1,151 @@
 package connectors
 
 import (
-	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"syscall"
 )
 
 // CmdWrapper wrap a exec.Cmd, or its fake
 type CmdWrapper interface {
-	// Prepare sets the command and its parameters that are wrapped by CmdWrapper
-	Prepare(command string, params []string)
-	// CmdExec executes the command wrapped by CmdWrapper
-	CmdExec() (string, error)
+	// Prepare sets the command, its parameters and its options that are wrapped by CmdWrapper
+	Prepare(command string, params []string, opts CmdOptions)
+	// CmdExec executes the command wrapped by CmdWrapper, until its completion or the cancellation of ctx
+	CmdExec(ctx context.Context) (string, error)
 }
 
+// CmdOptions holds the optional settings of a command
+type CmdOptions struct {
+	// Env holds the environment variables, NAME=value, added to the environment of the agent
+	Env []string
+	// Dir is the working directory of the command, the one of the agent if empty
+	Dir string
+	// Stdout and Stderr receive the whole outputs of the command, which
+	// are otherwise only buffered up to MaxBufferedOutput bytes
+	Stdout io.Writer
+	Stderr io.Writer
+	// OnStart is called with the pid of the command before it runs, the
+	// command is killed if it returns an error
+	OnStart func(pid int) error
+}
+
+// MaxBufferedOutput is the number of bytes of each output kept in memory by CmdExec
+const MaxBufferedOutput = 64 * 1024
+
+// gateScript holds the command until its gate, file descriptor 3, is closed by CmdExec, and then
+// replaces itself by the command: OnStart runs with the pid of the command before it does anything.
+const gateScript = `read -r _ <&3; exec 3<&-; exec "$@"`
+
 // Connector represents a command being prepared to be run
 type Connector struct {
-	cmd *exec.Cmd
+	cmd  *exec.Cmd
+	opts CmdOptions
 }
 
-// Prepare sets the command and parameters to be called
-func (c *Connector) Prepare(command string, params []string) {
+// Prepare sets the command, parameters and options to be called
+func (c *Connector) Prepare(command string, params []string, opts CmdOptions) {
+	if opts.OnStart != nil {
+		params = append([]string{"-c", gateScript, "gate", command}, params...)
+		command = "sh"
+	}
 	c.cmd = exec.Command(command, params...)
+	c.opts = opts
+	c.cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		c.cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	// run the command in its own process group, so that
+	// the processes it spawned are killed along with it
+	c.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
-// CmdExec runs the command on the underlying system and returns the stdout or stderr as a string
-func (c *Connector) CmdExec() (string, error) {
-	var stdout, stderr bytes.Buffer
-	c.cmd.Stdout = &stdout
-	c.cmd.Stderr = &stderr
-	err := c.cmd.Run()
+// CmdExec runs the command on the underlying system and returns the stdout or stderr as a string,
+// truncated to MaxBufferedOutput bytes. When ctx is done before the command completes, the whole
+// process group of the command is killed and ctx.Err() is returned.
+func (c *Connector) CmdExec(ctx context.Context) (string, error) {
+	stdout := &limitedBuffer{max: MaxBufferedOutput}
+	stderr := &limitedBuffer{max: MaxBufferedOutput}
+	c.cmd.Stdout = teeWriter(stdout, c.opts.Stdout)
+	c.cmd.Stderr = teeWriter(stderr, c.opts.Stderr)
+	var gate *os.File
+	if c.opts.OnStart != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err.Error(), err
+		}
+		defer r.Close()
+		defer w.Close()
+		c.cmd.ExtraFiles = []*os.File{r}
+		gate = w
+	}
+	if err := c.cmd.Start(); err != nil {
+		return err.Error(), err
+	}
+	if gate != nil {
+		if err := c.opts.OnStart(c.cmd.Process.Pid); err != nil {
+			_ = syscall.Kill(-c.cmd.Process.Pid, syscall.SIGKILL)
+			_ = c.cmd.Wait()
+			return err.Error(), err
+		}
+		// opens the gate
+		gate.Close()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.cmd.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the negative pid targets the process group
+		_ = syscall.Kill(-c.cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = ctx.Err()
+	}
 	outStr, errStr := stdout.String(), stderr.String()
 	if err != nil {
 		return errStr, err
 	}
 	return outStr, nil
 }
+
+// teeWriter returns a writer duplicating its writes to w, if not nil
+func teeWriter(buf *limitedBuffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
+
+// limitedBuffer keeps the first max bytes written to it, and discards the others
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	discarded int64
+}
+
+// Write never fails, so that the command isn't stopped by a full buffer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - len(b.buf); room < n {
+		b.buf = append(b.buf, p[:room]...)
+		b.discarded += int64(n - room)
+		return n, nil
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// String returns the buffered bytes, followed by the number of bytes discarded if any
+func (b *limitedBuffer) String() string {
+	if b.discarded > 0 {
+		return fmt.Sprintf("%s\n[%d bytes truncated]", b.buf, b.discarded)
+	}
+	return string(b.buf)
+}
@@ -0,0 +1,88 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCmdExec(t *testing.T) {
+	c := &Connector{}
+	c.Prepare("sh", []string{"-c", "echo hello"}, CmdOptions{})
+	out, err := c.CmdExec(context.Background())
+	if err != nil || out != "hello\n" {
+		t.Errorf("expected hello but got %q: %v", out, err)
+	}
+}
+
+func TestCmdExecEnv(t *testing.T) {
+	c := &Connector{}
+	c.Prepare("sh", []string{"-c", "echo \"$GREETING\""}, CmdOptions{Env: []string{"GREETING=hello; exit 1"}})
+	out, err := c.CmdExec(context.Background())
+	if err != nil || out != "hello; exit 1\n" {
+		t.Errorf("expected the value of GREETING but got %q: %v", out, err)
+	}
+}
+
+func TestCmdExecOnStart(t *testing.T) {
+	c := &Connector{}
+	onStart := func(pid int) error {
+		limit := unix.Rlimit{Cur: 64, Max: 64}
+		return unix.Prlimit(pid, unix.RLIMIT_NOFILE, &limit, nil)
+	}
+	// the limit is applied before the command runs
+	c.Prepare("sh", []string{"-c", "ulimit -n"}, CmdOptions{OnStart: onStart})
+	out, err := c.CmdExec(context.Background())
+	if err != nil || out != "64\n" {
+		t.Errorf("expected the limit set by OnStart but got %q: %v", out, err)
+	}
+
+	c.Prepare("sh", []string{"-c", "echo started"}, CmdOptions{OnStart: func(int) error { return errors.New("no limits") }})
+	out, err = c.CmdExec(context.Background())
+	if err == nil || strings.Contains(out, "started") {
+		t.Errorf("expected the command to be killed, but got %q: %v", out, err)
+	}
+}
+
+func TestCmdExecCancelled(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	c := &Connector{}
+	// the background sleep is part of the process group of the script
+	c.Prepare("sh", []string{"-c", "sleep 60 & echo $! > " + pidFile + "; wait"}, CmdOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err := c.CmdExec(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 10*time.Second {
+		t.Errorf("expected the script to be killed, but it ran for %v", elapsed)
+	}
+
+	contents, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("unable to read the pid of the background process: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the killed process is either gone or a zombie not reaped yet
+	for i := 0; i < 50; i++ {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("expected the background process %d to be killed", pid)
+}
@@ -2,13 +2,17 @@
 
 package connectors
 
-import "os/exec"
+import (
+	"context"
+	"os/exec"
+)
 
 // FakeConnector is a structure that holds the shell command to fake-run, its parameters
 // as well as a Flag, that helps orient the behavior of the mock
 type FakeConnector struct {
 	command string
 	params  []string
+	opts    CmdOptions
 	Flag    ErrorFlag
 }
 
@@ -24,17 +28,25 @@ const (
 	WriteErr ErrorFlag = "write-error"
 	// Scripr Error instructs the FakeConnector to simulate an error
 	ScriptErr ErrorFlag = "script-error"
+	// Blocking instructs the FakeConnector to run until the cancellation of its context
+	Blocking ErrorFlag = "blocking"
 )
 
 // Prepare stores the command and parameters to be used by FakeConnector, preparing the call to CmdExec
 // Implementation of cmdWrapper.Prepare
-func (c *FakeConnector) Prepare(command string, params []string) {
+func (c *FakeConnector) Prepare(command string, params []string, opts CmdOptions) {
 	c.command = command
 	c.params = params
+	c.opts = opts
 }
 
 // CmdExec implements the cmdWrapper.CmdExec and returns fake responses based on FakeConnector.Flag
-func (c *FakeConnector) CmdExec() (string, error) {
+func (c *FakeConnector) CmdExec(ctx context.Context) (string, error) {
+	if c.Flag == Blocking {
+		<-ctx.Done()
+		return "signal: killed", ctx.Err()
+	}
+
 	if c.Flag == SocketErr {
 		return "curl: (7) Couldn't connect to server", &exec.ExitError{}
 	}
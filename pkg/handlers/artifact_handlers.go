@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/history"
+)
+
+// ListArtifacts is called when the agent receives an HTTP request on endpoint /runs/{id}/artifacts.
+// It returns the list of history.Artifact produced by the run, HTTP 404 if there are none.
+func (h *Handlers) ListArtifacts(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	artifacts, ok := h.runArtifacts(w, id)
+	if !ok {
+		return
+	}
+	if err := sendJSON(w, artifacts); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// GetArtifact is called when the agent receives an HTTP request on endpoint /runs/{id}/artifacts/{name}.
+// It sends the contents of the artifact, supporting range requests.
+func (h *Handlers) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	f, err := h.history.OpenArtifact(id, name)
+	if errors.Is(err, history.ErrArtifactNotFound) {
+		http.Error(w, fmt.Sprintf("artifact %s of run %s not found", name, id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error reading artifact", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "error reading artifact", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+	// ServeContent sets Content-Length and handles Range and If-Modified-Since headers
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// GetArtifactsArchive is called when the agent receives an HTTP request on endpoint /runs/{id}/artifacts.tar.gz.
+// It sends a tar.gz archive of all the artifacts produced by the run, built before being sent so that
+// its Content-Length is known and range requests are supported.
+func (h *Handlers) GetArtifactsArchive(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.runArtifacts(w, id); !ok {
+		return
+	}
+
+	f, modTime, err := h.history.Archive(id)
+	if err != nil {
+		http.Error(w, "error archiving artifacts", http.StatusInternalServerError)
+		hlog.Errorf("unable to archive the artifacts of run %s: %v", id, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id.String()+".tar.gz"))
+	// the archive of unchanged artifacts is identical: ranges of a previous download can be resumed
+	http.ServeContent(w, r, id.String()+".tar.gz", modTime, f)
+}
+
+// runArtifacts returns the artifacts of the run, or sends an HTTP error if they can't be listed or there are none.
+func (h *Handlers) runArtifacts(w http.ResponseWriter, id uuid.UUID) ([]history.Artifact, bool) {
+	artifacts, err := h.history.Artifacts(id)
+	if err != nil {
+		http.Error(w, "error listing artifacts", http.StatusInternalServerError)
+		hlog.Error(err)
+		return nil, false
+	}
+	if len(artifacts) == 0 {
+		http.Error(w, fmt.Sprintf("no artifact found for run %s", id), http.StatusNotFound)
+		return nil, false
+	}
+	return artifacts, true
+}
+
+// runIDFromRequest returns the run ID of the request path, or sends HTTP 400 if it's not valid.
+func runIDFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid run ID", http.StatusBadRequest)
+		return id, false
+	}
+	return id, true
+}
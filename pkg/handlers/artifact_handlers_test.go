@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/history"
+)
+
+func TestArtifactHandlers(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handlers{StorageFolder: dir, history: history.NewStore(dir)}
+	if err := os.WriteFile(filepath.Join(dir, "kubelet-"+validUID+".pprof"), []byte("0123456789"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/node-observability-runs/{id}/artifacts", h.ListArtifacts)
+	router.HandleFunc("/node-observability-runs/{id}/artifacts.tar.gz", h.GetArtifactsArchive)
+	router.HandleFunc("/node-observability-runs/{id}/artifacts/{name:.+}", h.GetArtifact)
+
+	testCases := []struct {
+		name          string
+		url           string
+		rangeHeader   string
+		expectedCode  int
+		expectedBody  string
+		expectedCType string
+	}{
+		{
+			name:          "List artifacts",
+			url:           "/node-observability-runs/" + validUID + "/artifacts",
+			expectedCode:  http.StatusOK,
+			expectedCType: "application/json",
+		},
+		{
+			name:         "List artifacts of unknown run",
+			url:          "/node-observability-runs/0f8fad5b-d9cb-469f-a165-70867728950e/artifacts",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:          "Download artifact",
+			url:           "/node-observability-runs/" + validUID + "/artifacts/kubelet-" + validUID + ".pprof",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "0123456789",
+			expectedCType: "application/octet-stream",
+		},
+		{
+			name:         "Download artifact range",
+			url:          "/node-observability-runs/" + validUID + "/artifacts/kubelet-" + validUID + ".pprof",
+			rangeHeader:  "bytes=2-5",
+			expectedCode: http.StatusPartialContent,
+			expectedBody: "2345",
+		},
+		{
+			name:         "Download file of another run",
+			url:          "/node-observability-runs/" + validUID + "/artifacts/agent.err",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:          "Download archive",
+			url:           "/node-observability-runs/" + validUID + "/artifacts.tar.gz",
+			expectedCode:  http.StatusOK,
+			expectedCType: "application/gzip",
+		},
+		{
+			name:         "Download archive range",
+			url:          "/node-observability-runs/" + validUID + "/artifacts.tar.gz",
+			rangeHeader:  "bytes=0-1",
+			expectedCode: http.StatusPartialContent,
+			// the magic number of gzip
+			expectedBody: "\x1f\x8b",
+		},
+		{
+			name:         "Invalid run ID",
+			url:          "/node-observability-runs/notAnID/artifacts.tar.gz",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://localhost"+tc.url, nil)
+			if tc.rangeHeader != "" {
+				r.Header.Set("Range", tc.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.expectedCode {
+				t.Fatalf("expected status code %d but was %d", tc.expectedCode, resp.StatusCode)
+			}
+			if tc.expectedCType != "" && resp.Header.Get("Content-Type") != tc.expectedCType {
+				t.Errorf("expected content type %q but was %q", tc.expectedCType, resp.Header.Get("Content-Type"))
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the downloads announce their length
+			if resp.StatusCode < http.StatusBadRequest && tc.expectedCType != "application/json" && resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+				t.Errorf("expected content length %d but was %q", len(body), resp.Header.Get("Content-Length"))
+			}
+			if tc.expectedBody != "" && string(body) != tc.expectedBody {
+				t.Errorf("expected body %q but was %q", tc.expectedBody, string(body))
+			}
+			if tc.expectedCType == "application/json" {
+				artifacts := []history.Artifact{}
+				if err := json.Unmarshal(body, &artifacts); err != nil {
+					t.Fatal(err)
+				}
+				if len(artifacts) != 1 || artifacts[0].Size != 10 {
+					t.Errorf("expected the kubelet profile of 10 bytes but got %v", artifacts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// cancelWaitTimeout is the time CancelRun waits for the cancelled run to finish
+const cancelWaitTimeout = 10 * time.Second
+
+// inflightRun is the run holding the lock
+type inflightRun struct {
+	cancel    context.CancelFunc
+	cancelled bool
+	// done is closed once the run is processed and the lock freed
+	done chan struct{}
+}
+
+// CancelRun is called when the agent receives an HTTP POST request on endpoint /runs/{id}/cancel.
+// It cancels the collectors or the script of the ongoing run, and returns:
+// * HTTP 404 if the run of the given ID is neither in progress nor queued,
+// * HTTP 200 with the run ID, once a queued run is removed from the queue,
+// * HTTP 200 with the cancelled runs.Run, once the run is recorded and the lock freed,
+// * HTTP 202 with the run ID if the run is still finishing after 10 seconds.
+func (h *Handlers) CancelRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if h.dequeue(id) {
+		hlog.Infof("queued run %s removed from the queue", id)
+		if err := sendUID(w, id); err != nil {
+			hlog.Error(err)
+		}
+		return
+	}
+
+	done, ok := h.cancelRun(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("run %s is neither in progress nor queued", id), http.StatusNotFound)
+		return
+	}
+	hlog.Infof("cancelling run %s", id)
+
+	select {
+	case <-done:
+	case <-time.After(cancelWaitTimeout):
+		respondAccepted(w, id)
+		return
+	}
+
+	arun, err := h.history.Get(id)
+	if err != nil {
+		http.Error(w, "error reading the run history", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	if err := sendJSON(w, arun); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// startRun registers the run of the given ID as in progress, and returns the
+// context of its collectors or script, done after timeout seconds or when cancelled.
+func (h *Handlers) startRun(id uuid.UUID, timeout int) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(timeout))
+	h.inflightMux.Lock()
+	defer h.inflightMux.Unlock()
+	if h.inflight == nil {
+		h.inflight = map[uuid.UUID]*inflightRun{}
+	}
+	h.inflight[id] = &inflightRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	return ctx
+}
+
+// cancelRun cancels the context of the run of the given ID, and returns
+// a channel closed once the run is finished, false if the run is not in progress.
+func (h *Handlers) cancelRun(id uuid.UUID) (<-chan struct{}, bool) {
+	h.inflightMux.Lock()
+	defer h.inflightMux.Unlock()
+	run, ok := h.inflight[id]
+	if !ok {
+		return nil, false
+	}
+	run.cancelled = true
+	run.cancel()
+	return run.done, true
+}
+
+// runCancelled returns true if the run of the given ID was cancelled.
+func (h *Handlers) runCancelled(id uuid.UUID) bool {
+	h.inflightMux.Lock()
+	defer h.inflightMux.Unlock()
+	run, ok := h.inflight[id]
+	return ok && run.cancelled
+}
+
+// markCancelled marks the execution run in error as cancelled if it was stopped by the cancellation
+// of the run of the given ID: the context of the run is cancelled by then. The errors of the collectors
+// and scripts which failed for other reasons, before the cancellation, are kept.
+func (h *Handlers) markCancelled(ctx context.Context, id uuid.UUID, er runs.ExecutionRun) runs.ExecutionRun {
+	if er.Error != "" && errors.Is(ctx.Err(), context.Canceled) && h.runCancelled(id) {
+		er.Cancelled = true
+		er.Error = ""
+	}
+	return er
+}
+
+// finishRun releases the context of the run of the given ID, and notifies
+// the cancellation requests waiting for the end of the run.
+func (h *Handlers) finishRun(id uuid.UUID) {
+	h.inflightMux.Lock()
+	defer h.inflightMux.Unlock()
+	run, ok := h.inflight[id]
+	if !ok {
+		return
+	}
+	run.cancel()
+	close(run.done)
+	delete(h.inflight, id)
+}
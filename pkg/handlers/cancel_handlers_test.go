@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/connectors"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestCancelRun(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.Connector = &connectors.FakeConnector{Flag: connectors.Blocking}
+	router := mux.NewRouter()
+	router.HandleFunc("/node-observability-scripting", h.HandleScripting)
+	router.HandleFunc("/node-observability-runs/{id}/cancel", h.CancelRun).Methods(http.MethodPost)
+
+	// unknown run
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-runs/"+validUID+"/cancel", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d cancelling an unknown run but was %d", http.StatusNotFound, w.Code)
+	}
+
+	// start a script running until cancelled
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost/node-observability-scripting", nil))
+	var started runs.Run
+	if err := json.NewDecoder(w.Result().Body).Decode(&started); err != nil {
+		t.Fatalf("unable to decode run: %v", err)
+	}
+	if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.Taken {
+		t.Fatalf("expected the agent to be busy but was %s", s)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-runs/"+started.ID.String()+"/cancel", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d but was %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var cancelled runs.Run
+	if err := json.NewDecoder(w.Result().Body).Decode(&cancelled); err != nil {
+		t.Fatalf("unable to decode run: %v", err)
+	}
+	if cancelled.ID != started.ID || len(cancelled.ExecutionRuns) != 1 {
+		t.Fatalf("expected run %s with one execution run but got %v", started.ID, cancelled)
+	}
+	if er := cancelled.ExecutionRuns[0]; !er.Cancelled || er.Successful || er.Error != "" {
+		t.Errorf("expected the execution run to be cancelled without error, but got %+v", er)
+	}
+	if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.Free {
+		t.Errorf("expected the agent to be free but was %s", s)
+	}
+	if _, err := os.Stat(h.errorOutputFilePath()); err == nil {
+		t.Error("expected no error file for a cancelled run")
+	}
+}
+
+func TestMarkCancelled(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	uid := uuid.MustParse(validUID)
+	ctx := h.startRun(uid, 60)
+	defer h.finishRun(uid)
+
+	// a collector failing on its own before the cancellation
+	failed := h.markCancelled(ctx, uid, runs.ExecutionRun{Type: runs.KubeletRun, Error: "401 Unauthorized"})
+	if failed.Cancelled || failed.Error == "" {
+		t.Errorf("expected the error of the collector to be kept, but got %+v", failed)
+	}
+
+	if _, ok := h.cancelRun(uid); !ok {
+		t.Fatal("expected the run to be in progress")
+	}
+	stopped := h.markCancelled(ctx, uid, runs.ExecutionRun{Type: runs.CrioRun, Error: "context canceled"})
+	if !stopped.Cancelled || stopped.Error != "" {
+		t.Errorf("expected the collector stopped by the cancellation to be cancelled without error, but got %+v", stopped)
+	}
+	successful := h.markCancelled(ctx, uid, runs.ExecutionRun{Type: runs.SystemRun, Successful: true})
+	if successful.Cancelled {
+		t.Errorf("expected the successful collector not to be cancelled, but got %+v", successful)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.Connector = &connectors.FakeConnector{Flag: connectors.Blocking}
+	uid, _, err := h.stateLocker.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the script killed at its timeout reports its own error, before the results are timed out
+	h.startScripting(uid, scriptRun{command: "sh", timeout: 1})
+	for i := 0; i < 50; i++ {
+		if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.Taken {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	arun, err := h.history.Get(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arun.ExecutionRuns) != 1 {
+		t.Fatalf("expected one execution run but got %+v", arun.ExecutionRuns)
+	}
+	if er := arun.ExecutionRuns[0]; er.Successful || er.Signal != "SIGKILL" || strings.HasPrefix(er.Error, "timeout") {
+		t.Errorf("expected the script to be killed at its timeout, but got %+v", er)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connContextKey is the key of the connection of a request in its context
+type connContextKey struct{}
+
+// writeTimeoutContextKey is the key of the write timeout of a request in its context
+type writeTimeoutContextKey struct{}
+
+// ConnContext stores the connection in the context of its requests, to be set as the ConnContext
+// of the http.Server, so that WriteDeadline can set the write deadline of the connection.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// WriteDeadline returns a middleware bounding the time to send each response to timeout, as
+// http.Server.WriteTimeout does. Unlike the timeout of the server, the deadline can be pushed
+// back by the handlers streaming for the whole run, with extendWriteDeadline.
+func WriteDeadline(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), writeTimeoutContextKey{}, timeout))
+			extendWriteDeadline(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// extendWriteDeadline gives the timeout of WriteDeadline to send the next writes of the response,
+// it does nothing if the request wasn't served through WriteDeadline and ConnContext.
+func extendWriteDeadline(r *http.Request) {
+	c, ok := r.Context().Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	timeout, ok := r.Context().Value(writeTimeoutContextKey{}).(time.Duration)
+	if !ok || timeout <= 0 {
+		return
+	}
+	if err := c.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		hlog.Errorf("unable to set the write deadline: %v", err)
+	}
+}
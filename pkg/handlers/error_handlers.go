@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+const bearerPrefix = "Bearer "
+
+// ClearError is called when the agent receives an HTTP DELETE request on endpoint /error.
+// It requires the admin token as bearer token and returns:
+// * HTTP 401 if the admin token is missing or wrong,
+// * HTTP 409 if the agent is not in error,
+// * HTTP 200 with the runs.Run in error, once archived in the run history and the error cleared.
+// The next queued run, if any, is started once the error is cleared.
+func (h *Handlers) ClearError(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid or missing admin token", http.StatusUnauthorized)
+		return
+	}
+
+	arun, err := h.clearError(func(arun runs.Run) error {
+		return writeRunToFile(arun, h.runLogOutputFilePath(arun))
+	})
+	if errors.Is(err, statelocker.ErrNotInError) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "unable to clear the error", http.StatusInternalServerError)
+		hlog.Errorf("unable to clear the error: %v", err)
+		return
+	}
+
+	h.metrics.ErrorCleared(time.Since(arun.EndTime()))
+	hlog.Infof("error of run %s cleared", arun.ID)
+	if err := sendJSON(w, arun); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// isAdmin returns true if the request holds the admin token as bearer token.
+// No request is admin when the agent has no admin token.
+func (h *Handlers) isAdmin(r *http.Request) bool {
+	if h.AdminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return false
+	}
+	token := strings.TrimPrefix(auth, bearerPrefix)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) == 1
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestClearError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		isError       bool
+		expectedCode  int
+		expectedState statelocker.State
+	}{
+		{
+			name:          "No admin token configured, HTTP 401",
+			authorization: "Bearer ",
+			isError:       true,
+			expectedCode:  http.StatusUnauthorized,
+			expectedState: statelocker.InError,
+		},
+		{
+			name:          "Missing token, HTTP 401",
+			adminToken:    "admin",
+			isError:       true,
+			expectedCode:  http.StatusUnauthorized,
+			expectedState: statelocker.InError,
+		},
+		{
+			name:          "Wrong token, HTTP 401",
+			adminToken:    "admin",
+			authorization: "Bearer abc",
+			isError:       true,
+			expectedCode:  http.StatusUnauthorized,
+			expectedState: statelocker.InError,
+		},
+		{
+			name:          "Not in error, HTTP 409",
+			adminToken:    "admin",
+			authorization: "Bearer admin",
+			expectedCode:  http.StatusConflict,
+			expectedState: statelocker.Free,
+		},
+		{
+			name:          "In error, error cleared, HTTP 200",
+			adminToken:    "admin",
+			authorization: "Bearer admin",
+			isError:       true,
+			expectedCode:  http.StatusOK,
+			expectedState: statelocker.Free,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			h := NewScriptingHandlers(dir, "127.0.0.1")
+			h.AdminToken = tc.adminToken
+			runInError := runs.Run{
+				ID: uuid.MustParse(validUID),
+				ExecutionRuns: []runs.ExecutionRun{
+					{Type: runs.ScriptingRun, Error: "fake error"},
+				},
+			}
+			if tc.isError {
+				if err := h.stateLocker.SetError(runInError); err != nil {
+					t.Fatalf("unexpected error preparing test: %v", err)
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodDelete, "http://localhost/node-observability-error", nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			h.ClearError(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedCode {
+				t.Errorf("expected status code %d but was %d", tc.expectedCode, resp.StatusCode)
+			}
+			if _, s, _ := h.stateLocker.LockInfo(); s != tc.expectedState {
+				t.Errorf("expected state to be %s but was %s", tc.expectedState, s)
+			}
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var arun runs.Run
+			if err := json.NewDecoder(resp.Body).Decode(&arun); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			if arun.ID != runInError.ID {
+				t.Errorf("expected run %s to be returned but was %s", runInError.ID, arun.ID)
+			}
+			if _, err := os.Stat(h.runLogOutputFilePath(arun)); err != nil {
+				t.Errorf("expected run to be archived in the history: %v", err)
+			}
+		})
+	}
+}
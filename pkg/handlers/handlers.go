@@ -5,29 +5,38 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 
+	"github.com/openshift/node-observability-agent/pkg/collectors"
 	"github.com/openshift/node-observability-agent/pkg/connectors"
+	"github.com/openshift/node-observability-agent/pkg/history"
+	"github.com/openshift/node-observability-agent/pkg/metrics"
 	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
 	"github.com/openshift/node-observability-agent/pkg/statelocker"
+	"github.com/openshift/node-observability-agent/pkg/version"
 )
 
 const (
-	ready                    = "Service is ready"
-	httpRespErrMsg           = "unable to send response"
-	baseTimeout       int    = 35
-	logFileExt        string = "log"
-	errorFileExt      string = "err"
-	pprofFileExt      string = "pprof"
-	crioFilePrefix    string = "crio"
-	kubeletFilePrefix string = "kubelet"
+	ready                 = "Service is ready"
+	httpRespErrMsg        = "unable to send response"
+	logFileExt     string = "log"
+	errorFileExt   string = "err"
+	// scriptingTimeout is the time in seconds after which the EXECUTE_SCRIPT script is killed
+	scriptingTimeout = scripts.DefaultTimeoutSeconds
+	// resultsTimeoutMargin is the time in seconds the results are awaited after the timeout of the collectors
+	// and scripts: stopped at their timeout, they report their own errors, and only the ones which don't
+	// return within the margin are reported as timed out by processResults
+	resultsTimeoutMargin = 5
 )
 
 var (
@@ -37,6 +46,7 @@ var (
 // Handlers holds the parameters necessary for running the CRIO, Kubelet profiling as well as scripting
 type Handlers struct {
 	Token                string
+	AdminToken           string
 	NodeIP               string
 	StorageFolder        string
 	CrioUnixSocket       string
@@ -45,10 +55,30 @@ type Handlers struct {
 	stateLocker          statelocker.StateLocker
 	Connector            connectors.CmdWrapper
 	Mode                 string
+	registry             *collectors.Registry
+	pprofTargets         []string
+	samplers             []string
+	history              *history.Store
+	metrics              *metrics.Metrics
+	inflightMux          sync.Mutex
+	inflight             map[uuid.UUID]*inflightRun
+	// ScriptCatalog holds the scripts which can be selected by name in the scripting requests
+	ScriptCatalog *scripts.Catalog
+	// ScriptCgroupParent is the cgroup v2 directory under which the scripts
+	// declaring cgroup limits get a dedicated cgroup
+	ScriptCgroupParent string
+	// ScriptAllowlist holds the digests of the scripts which can be run, all scripts can be run if nil
+	ScriptAllowlist *scripts.Allowlist
+	// QueueSize is the number of runs which can wait for the ongoing run,
+	// the runs are rejected while the agent is busy if 0
+	QueueSize int
+	queueMux  sync.Mutex
+	queue     []queuedRun
 }
 
-// NewHandlers creates a new instance of Handlers from the given parameters
-func NewHandlers(token string, caCerts *x509.CertPool, storageFolder string, crioUnixSocket string, nodeIP string, crioPreferUnixSocket bool) *Handlers {
+// NewHandlers creates a new instance of Handlers from the given parameters.
+// The kubelet and CRIO pprof targets are registered as data sources of the profiling mode.
+func NewHandlers(token string, caCerts *x509.CertPool, storageFolder string, crioUnixSocket string, nodeIP string, crioPreferUnixSocket bool, traceMaxBytes int64) *Handlers {
 	h := &Handlers{
 		Token:                token,
 		CACerts:              caCerts,
@@ -57,8 +87,16 @@ func NewHandlers(token string, caCerts *x509.CertPool, storageFolder string, cri
 		CrioUnixSocket:       crioUnixSocket,
 		CrioPreferUnixSocket: crioPreferUnixSocket,
 		Mode:                 "profiling",
+		registry:             collectors.NewRegistry(),
+		history:              history.NewStore(storageFolder),
 	}
 	h.stateLocker = statelocker.NewStateLock(h.errorOutputFilePath())
+	h.metrics = metrics.New(h.metricsState)
+	// the registry is empty: registering the built-in targets cannot fail
+	_ = h.RegisterPprofTargets(
+		collectors.NewKubeletTarget(nodeIP, token, caCerts, traceMaxBytes),
+		collectors.NewCrioTarget(crioUnixSocket, crioPreferUnixSocket, traceMaxBytes),
+	)
 	return h
 }
 
@@ -69,16 +107,44 @@ func NewScriptingHandlers(storageFolder string, nodeIP string) *Handlers {
 		StorageFolder: storageFolder,
 		Connector:     &connectors.Connector{},
 		Mode:          "scripting",
+		history:       history.NewStore(storageFolder),
 	}
 	h.stateLocker = statelocker.NewStateLock(h.errorOutputFilePath())
+	h.metrics = metrics.New(h.metricsState)
 	return h
 }
 
+// EnableScripting enables the scripting mode in the Handlers of the profiling mode,
+// both modes sharing the storage folder, the run history and the lock.
+// Mode is left to the caller, which knows the set of enabled modes.
+func (h *Handlers) EnableScripting() {
+	h.Connector = &connectors.Connector{}
+}
+
+// StatusDocument is the status of the agent sent to the clients accepting JSON
+type StatusDocument struct {
+	State statelocker.State
+	// RunID is the ID of the ongoing run, or of the run in error
+	RunID *uuid.UUID
+	// StartTime is the begin time of the ongoing run, or of the run in error
+	StartTime *time.Time
+	// ElapsedSeconds is the time spent so far by the ongoing run
+	ElapsedSeconds float64
+	// Collectors are the collectors of the profiling mode, or the script of the scripting mode
+	Collectors []string
+	Mode       string
+	Version    string
+	// QueueDepth is the number of queued runs, listed in Queue in the order they will be run
+	QueueDepth int
+	Queue      []QueuedRunStatus
+}
+
 // Status is called when the agent receives an HTTP request on endpoint /status.
 // It returns:
 // * HTTP 500 if the agent is in error,
 // * HTTP 409 if a previous profiling is still ongoing,
 // * HTTP 200 if the agent is ready
+// The body is a StatusDocument if the client accepts application/json, a text message otherwise.
 func (h *Handlers) Status(w http.ResponseWriter, r *http.Request) {
 	hlog.Infof("start handling status request")
 
@@ -88,6 +154,12 @@ func (h *Handlers) Status(w http.ResponseWriter, r *http.Request) {
 		hlog.Errorf("error retrieving service status : %v", err)
 		return
 	}
+	if acceptsJSON(r) {
+		if err := h.sendStatusDocument(w, id, state); err != nil {
+			hlog.Error(err)
+		}
+		return
+	}
 	switch state {
 	case statelocker.InError:
 		hlog.Infof("agent is in error state, runID: %s", id.String())
@@ -114,14 +186,99 @@ func (h *Handlers) Status(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sendStatusDocument sends the StatusDocument of the given state,
+// with the HTTP status code matching the state.
+func (h *Handlers) sendStatusDocument(w http.ResponseWriter, id uuid.UUID, state statelocker.State) error {
+	doc := StatusDocument{
+		State:      state,
+		Collectors: h.collectorNames(),
+		Mode:       h.Mode,
+		Version:    version.Version(),
+		Queue:      h.queueStatus(),
+	}
+	doc.QueueDepth = len(doc.Queue)
+	code := http.StatusOK
+	switch state {
+	case statelocker.InError:
+		code = http.StatusInternalServerError
+		doc.RunID = &id
+		// the runs in error are part of the history
+		if arun, err := h.history.Get(id); err == nil {
+			begin := arun.BeginTime()
+			doc.StartTime = &begin
+		}
+	case statelocker.Taken:
+		code = http.StatusConflict
+		doc.RunID = &id
+		if begin := h.stateLocker.LockTime(); !begin.IsZero() {
+			doc.StartTime = &begin
+			doc.ElapsedSeconds = time.Since(begin).Seconds()
+		}
+	}
+
+	jsResponse, err := json.Marshal(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return fmt.Errorf("unable to marshal status: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(jsResponse); err != nil {
+		return fmt.Errorf("unable to send HTTP response: %w", err)
+	}
+	return nil
+}
+
+// collectorNames returns the names of the registered collectors
+// in profiling mode, and the script to execute in scripting mode.
+func (h *Handlers) collectorNames() []string {
+	names := []string{}
+	if h.registry != nil {
+		names = append(names, h.registry.Names()...)
+	}
+	if script := os.Getenv("EXECUTE_SCRIPT"); h.Connector != nil && script != "" {
+		names = append(names, script)
+	}
+	if h.Connector != nil && h.ScriptCatalog != nil {
+		for _, script := range h.ScriptCatalog.Scripts {
+			names = append(names, scriptCollectorName+"/"+script.Name)
+		}
+	}
+	return names
+}
+
+// acceptsJSON returns true if the Accept header of the request lists application/json.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // HandleProfiling is called when the agent receives an HTTP request on endpoint /pprof
 // After checking the agent is not in error, and that no previous profiling is still ongoing,
-// it triggers the kubelet and CRIO profiling in separate goroutines, and launches a separate
-// function to process the results in a goroutine as well
+// it runs each of the collectors built from the request in separate goroutines, and launches
+// a separate function to process the results in a goroutine as well.
+// It returns HTTP 400 if the optional ProfilingRequest body is invalid.
+// When the agent is busy and the queue has room, the run is queued and HTTP 202 is returned.
 func (h *Handlers) HandleProfiling(w http.ResponseWriter, r *http.Request) {
 	hlog.Info("start handling execution request")
 
-	uid, state, err := h.stateLocker.Lock()
+	preq, err := h.parseProfilingRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		hlog.Error(err)
+		return
+	}
+
+	uid, state, err := h.acquire(func(uid uuid.UUID) {
+		h.startProfiling(uid, preq)
+	})
 	if err != nil {
 		http.Error(w, "service is either busy or in error, try again", http.StatusInternalServerError)
 		hlog.Error(err)
@@ -151,22 +308,14 @@ func (h *Handlers) HandleProfiling(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+	case statelocker.Queued:
+		{
+			hlog.Infof("previous execution is still ongoing, profiling queued, runID: %s", uid.String())
+			respondAccepted(w, uid)
+		}
 	case statelocker.Free:
 		{
-			hlog.Infof("ready to initiate profiling, runID: %s", uid.String())
-			// Channel for collecting results of profiling
-			runResultsChan := make(chan runs.ExecutionRun)
-
-			// Launch both profilings in parallel as well as the routine to wait for results
-			go func() {
-				runResultsChan <- h.profileKubelet(uid.String())
-			}()
-
-			go func() {
-				runResultsChan <- h.profileCrio(uid.String())
-			}()
-
-			go h.processResults(uid, runResultsChan, baseTimeout)
+			hlog.Infof("initiated profiling, runID: %s", uid.String())
 			// Send a HTTP 200 straight away
 			err := sendUID(w, uid)
 			if err != nil {
@@ -177,12 +326,48 @@ func (h *Handlers) HandleProfiling(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// startProfiling runs each of the collectors built from the request in separate goroutines,
+// and launches a separate function to process the results in a goroutine as well.
+func (h *Handlers) startProfiling(uid uuid.UUID, preq ProfilingRequest) {
+	cs := h.registry.Collectors(preq.params())
+	// Channel for collecting results of profiling, buffered so that
+	// collectors finishing after the timeout don't block
+	runResultsChan := make(chan runs.ExecutionRun, len(cs))
+	// Collectors are stopped at the timeout, once the results are processed, or when the run is cancelled
+	ctx := h.startRun(uid, preq.timeout())
+
+	// Launch all the collectors in parallel as well as the routine to wait for results
+	expected := make([]runs.RunType, 0, len(cs))
+	for _, c := range cs {
+		expected = append(expected, c.Type())
+		h.metrics.RunStarted(c.Type())
+		go func(c collectors.Collector) {
+			hlog.Debugf("starting collector %s, runID: %s", c.Name(), uid.String())
+			er := h.markCancelled(ctx, uid, c.Collect(ctx, uid.String(), h.StorageFolder))
+			h.metrics.ObserveCollector(c.Name(), er)
+			runResultsChan <- er
+		}(c)
+	}
+
+	go h.processResults(uid, runResultsChan, expected, preq.timeout()+resultsTimeoutMargin)
+}
+
 // HandleScripting is called when the agent receives an HTTP request on endpoint /scripting
 // After checking the agent is not in error, and that no previous profiling is still ongoing,
 // it triggers the embedded script in a separate goroutine, and launches a separate
-// function to process the results in a goroutine as well
+// function to process the results in a goroutine as well.
+// When the agent is busy and the queue has room, the run is queued and HTTP 202 is returned.
 func (h *Handlers) HandleScripting(w http.ResponseWriter, r *http.Request) {
-	uid, state, err := h.stateLocker.Lock()
+	srun, err := h.parseScriptingRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		hlog.Error(err)
+		return
+	}
+
+	uid, state, err := h.acquire(func(uid uuid.UUID) {
+		h.startScripting(uid, srun)
+	})
 	if err != nil {
 		http.Error(w, "service is either busy or in error, try again",
 			http.StatusInternalServerError)
@@ -213,19 +398,12 @@ func (h *Handlers) HandleScripting(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+	case statelocker.Queued:
+		{
+			respondAccepted(w, uid)
+		}
 	case statelocker.Free:
 		{
-
-			// Channel for collecting results of metrics
-			runResultsChan := make(chan runs.ExecutionRun)
-
-			// Launch metrics script as the routine to wait for results
-			go func() {
-				h.Connector.Prepare("sh", []string{"-c", os.Getenv("EXECUTE_SCRIPT")})
-				runResultsChan <- h.executeScript(uid.String(), h.Connector)
-			}()
-
-			go h.processResults(uid, runResultsChan, 7200)
 			// Send a HTTP 200 straight away
 			err := sendUID(w, uid)
 			if err != nil {
@@ -236,67 +414,74 @@ func (h *Handlers) HandleScripting(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handlers) processResults(uid uuid.UUID, runResultsChan chan runs.ExecutionRun, timeout int) {
+// startScripting triggers the script in a separate goroutine, and launches
+// a separate function to process the results in a goroutine as well.
+func (h *Handlers) startScripting(uid uuid.UUID, srun scriptRun) {
+	// Channel for collecting results of metrics, buffered so that
+	// a script finishing after the timeout doesn't block
+	runResultsChan := make(chan runs.ExecutionRun, 1)
+
+	// Launch metrics script as the routine to wait for results
+	// The script is killed at its timeout, once the results are processed, or when the run is cancelled
+	ctx := h.startRun(uid, srun.timeout)
+	h.metrics.RunStarted(runs.ScriptingRun)
+	go func() {
+		er := h.markCancelled(ctx, uid, h.executeScript(ctx, uid.String(), srun, h.Connector))
+		h.metrics.ObserveCollector(srun.collectorName(), er)
+		runResultsChan <- er
+	}()
+
+	go h.processResults(uid, runResultsChan, []runs.RunType{runs.ScriptingRun}, srun.timeout+resultsTimeoutMargin)
+}
+
+// processResults waits for the execution runs of the expected types on runResultsChan, at most
+// timeout seconds, then writes the run into the storage folder or sets the agent in error.
+// The execution runs missing at the timeout are reported in error with their expected type.
+func (h *Handlers) processResults(uid uuid.UUID, runResultsChan chan runs.ExecutionRun, expected []runs.RunType, timeout int) {
 	arun := runs.Run{
 		ID:            uid,
 		ExecutionRuns: []runs.ExecutionRun{},
 	}
-	// unlock as soon as finished processing
-	defer func() {
-		err := h.stateLocker.Unlock()
-		if err != nil {
-			hlog.Fatal(err)
-		}
-		close(runResultsChan)
-	}()
-
-	if h.Mode == "profiling" {
-		// wait for the results
-		arun.ExecutionRuns = []runs.ExecutionRun{}
-		isTimeout := false
-
-		hlog.Infof("start processing results of profiling requests, runID: %s", uid.String())
-		for nb := 0; nb < 2 && !isTimeout; {
-			select {
-			case er := <-runResultsChan:
-				nb++
-				arun.ExecutionRuns = append(arun.ExecutionRuns, er)
-			case <-time.After(time.Second * time.Duration(timeout)):
-				//timeout! dont wait anymore
-				erInTimeout := runs.ExecutionRun{
-					Type:       runs.UnknownRun,
-					Successful: false,
-					BeginTime:  time.Now(),
-					EndTime:    time.Now(),
-					Error:      fmt.Sprintf("timeout after waiting %ds", timeout),
-				}
-				erInTimeout.Error = fmt.Sprintf("timeout after waiting %ds", timeout)
-				arun.ExecutionRuns = append(arun.ExecutionRuns, erInTimeout)
-				isTimeout = true
-			}
-		}
-	} else {
+	// notify the cancellation requests once unlocked
+	defer h.finishRun(uid)
+	// unlock as soon as finished processing, handing the lock to the next queued run
+	defer h.release()
+
+	// wait for the results
+	hlog.Infof("start processing results of %d execution runs, runID: %s", len(expected), uid.String())
+	pending := append([]runs.RunType{}, expected...)
+	deadline := time.NewTimer(time.Second * time.Duration(timeout))
+	defer deadline.Stop()
+	for isTimeout := false; len(pending) > 0 && !isTimeout; {
 		select {
 		case er := <-runResultsChan:
+			pending = removeRunType(pending, er.Type)
 			arun.ExecutionRuns = append(arun.ExecutionRuns, er)
-		case <-time.After(time.Second * time.Duration(timeout)):
+		case <-deadline.C:
 			//timeout! dont wait anymore
-			erInTimeout := runs.ExecutionRun{
-				Type:       runs.UnknownRun,
-				Successful: false,
-				BeginTime:  time.Now(),
-				EndTime:    time.Now(),
-				Error:      fmt.Sprintf("timeout after waiting %ds", timeout),
+			for _, t := range pending {
+				arun.ExecutionRuns = append(arun.ExecutionRuns, runs.ExecutionRun{
+					Type:       t,
+					Successful: false,
+					BeginTime:  time.Now(),
+					EndTime:    time.Now(),
+					Error:      fmt.Sprintf("timeout after waiting %ds", timeout),
+				})
 			}
-			erInTimeout.Error = fmt.Sprintf("timeout after waiting %ds", timeout)
-			arun.ExecutionRuns = append(arun.ExecutionRuns, erInTimeout)
+			isTimeout = true
 		}
 	}
 
+	// the execution runs which failed because of the cancellation were marked as cancelled by markCancelled
+	if h.runCancelled(uid) {
+		hlog.Infof("run %s was cancelled", uid.String())
+	}
+
 	// Process the results
 	var errorMessage bytes.Buffer
 	var logMessage bytes.Buffer
 	for _, execRun := range arun.ExecutionRuns {
+		h.metrics.RunFinished(execRun)
 		if execRun.Error != "" {
 			errorMessage.WriteString("errors encountered while running " + string(execRun.Type) + " - " + arun.ID.String() + ":\n")
 			errorMessage.WriteString(execRun.Error + "\n")
@@ -304,6 +489,12 @@ func (h *Handlers) processResults(uid uuid.UUID, runResultsChan chan runs.Execut
 		logMessage.WriteString("successfully finished executing mode '" + string(execRun.Type) + "' - " + arun.ID.String() + ": " + execRun.BeginTime.String() + " -> " + execRun.EndTime.String() + " ")
 	}
 
+	// keep all the runs, including the ones in error, in the run history
+	if err := writeRunToFile(arun, h.runLogOutputFilePath(arun)); err != nil {
+		hlog.Fatal(err)
+	}
+	h.countBytesWritten(uid)
+
 	if errorMessage.Len() > 0 {
 		hlog.Error(errorMessage.String())
 		err := h.stateLocker.SetError(arun)
@@ -313,9 +504,18 @@ func (h *Handlers) processResults(uid uuid.UUID, runResultsChan chan runs.Execut
 	} else {
 		// no errors : simply log the results
 		hlog.Info(logMessage.String())
-		if err := writeRunToFile(arun, h.runLogOutputFilePath(arun)); err != nil {
-			hlog.Fatal(err)
-		}
+	}
+}
+
+// countBytesWritten adds the size of the artifacts of the run to the bytes written.
+func (h *Handlers) countBytesWritten(uid uuid.UUID) {
+	artifacts, err := h.history.Artifacts(uid)
+	if err != nil {
+		hlog.Errorf("unable to count the bytes written by run %s: %v", uid, err)
+		return
+	}
+	for _, a := range artifacts {
+		h.metrics.AddBytesWritten(a.Size)
 	}
 }
 
@@ -327,16 +527,6 @@ func (h *Handlers) outputFilePath(prefix, id, ext string) string {
 	return filepath.Join(h.StorageFolder, prefix+id+"."+ext)
 }
 
-// crioPprofOutputFilePath returns the full file path for CRIO pprof output.
-func (h *Handlers) crioPprofOutputFilePath(id string) string {
-	return h.outputFilePath(crioFilePrefix, id, pprofFileExt)
-}
-
-// kubeletPprofOutputFilePath returns the full file path for Kubelet pprof output.
-func (h *Handlers) kubeletPprofOutputFilePath(id string) string {
-	return h.outputFilePath(kubeletFilePrefix, id, pprofFileExt)
-}
-
 // runLogOutputFilePath returns the full file path for pprof output.
 func (h *Handlers) runLogOutputFilePath(r runs.Run) string {
 	return h.outputFilePath("", r.ID.String(), logFileExt)
@@ -366,6 +556,15 @@ func sendUID(w http.ResponseWriter, runID uuid.UUID) error {
 	return nil
 }
 
+// respondAccepted sends the run ID with HTTP 202, for the runs queued or still being cancelled
+func respondAccepted(w http.ResponseWriter, uid uuid.UUID) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := sendUID(w, uid); err != nil {
+		hlog.Error(err)
+	}
+}
+
 func respondBusyOrError(uid string, w http.ResponseWriter, isError bool) error {
 	message := ""
 
@@ -383,6 +582,16 @@ func respondBusyOrError(uid string, w http.ResponseWriter, isError bool) error {
 	return nil
 }
 
+// removeRunType removes the first occurrence of t from types
+func removeRunType(types []runs.RunType, t runs.RunType) []runs.RunType {
+	for i := range types {
+		if types[i] == t {
+			return append(types[:i], types[i+1:]...)
+		}
+	}
+	return types
+}
+
 // writeRunToFile writes the contents of the run into the given file.
 func writeRunToFile(run runs.Run, filePath string) error {
 	bytes, err := json.Marshal(run)
@@ -394,17 +603,3 @@ func writeRunToFile(run runs.Run, filePath string) error {
 	}
 	return nil
 }
-
-// writeToFile writes the contents of the reader into the given file.
-func writeToFile(reader io.ReadCloser, filePath string) error {
-	out, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", filePath, err)
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, reader); err != nil {
-		return fmt.Errorf("failed to write to file %s: %w", filePath, err)
-	}
-	return nil
-}
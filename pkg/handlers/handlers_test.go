@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,7 +21,10 @@ import (
 )
 
 const (
-	validUID string = "dd37122b-daaf-4d75-9250-c0747e9c5c47"
+	validUID          string = "dd37122b-daaf-4d75-9250-c0747e9c5c47"
+	testTraceMaxBytes int64  = 1 << 20
+	// testProcRoot is the procfs fixture read by the samplers
+	testProcRoot = "../../test_resources/host/proc"
 )
 
 func TestStatus(t *testing.T) {
@@ -67,7 +71,7 @@ func TestStatus(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			r := httptest.NewRequest("GET", "http://localhost/node-observability-status", nil)
 			w := httptest.NewRecorder()
-			h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true)
+			h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
 			var cur uuid.UUID
 			if tc.isBusy {
 				c, _, err := h.stateLocker.Lock()
@@ -203,7 +207,7 @@ func TestHandleProfilingStateMgmt(t *testing.T) {
 	for _, tc := range testCases {
 
 		t.Run(tc.name, func(t *testing.T) {
-			h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true)
+			h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
 			r := httptest.NewRequest("GET", "http://localhost/node-observability-status", nil)
 			w := httptest.NewRecorder()
 			if tc.serverState == "busy" {
@@ -274,7 +278,7 @@ func TestHandleProfilingStateMgmt(t *testing.T) {
 }
 
 func TestProcessResults(t *testing.T) {
-	h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true)
+	h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
 
 	crioRunOK := runs.ExecutionRun{
 		Type:       runs.CrioRun,
@@ -384,7 +388,7 @@ func TestProcessResults(t *testing.T) {
 				t.Errorf("Unexpected error : %v", err)
 			}
 			defer cleanup(t)
-			h.processResults(uuid.MustParse(validUID), tc.channel, 35)
+			h.processResults(uuid.MustParse(validUID), tc.channel, []runs.RunType{runs.KubeletRun, runs.CrioRun}, 35)
 			uid, s, err := h.stateLocker.LockInfo()
 			if err != nil {
 				t.Errorf("unexpected error : %v", err)
@@ -440,7 +444,7 @@ func TestProcessResults(t *testing.T) {
 								t.Errorf("Expected log file /tmp/agent.err to contain kubelet run success = %t, but was %t", tc.expectedKubeletSuccess, aProfilingRun.Successful)
 							}
 						}
-						if aProfilingRun.Type == runs.UnknownRun && !tc.expectedTimeout {
+						if strings.HasPrefix(aProfilingRun.Error, "timeout") && !tc.expectedTimeout {
 							t.Error("timeout when none was expected")
 						}
 					}
@@ -450,16 +454,58 @@ func TestProcessResults(t *testing.T) {
 	}
 }
 
-func TestOutputFilePaths(t *testing.T) {
-	h := Handlers{StorageFolder: "/fakedir"}
-
-	if expected, got := "/fakedir/crio-fakeid.pprof", h.crioPprofOutputFilePath("fakeid"); expected != got {
-		t.Errorf("Wrong crio output path, expected: %q, but got: %q", expected, got)
+func TestProcessResultsMetrics(t *testing.T) {
+	h := NewHandlers("abc", makeCACertPool(), t.TempDir(), "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
+	expected := []runs.RunType{runs.KubeletRun, runs.CrioRun, runs.SystemRun}
+	for _, rt := range expected {
+		h.metrics.RunStarted(rt)
 	}
+	// the system sampler doesn't report before the timeout
+	results := make(chan runs.ExecutionRun, 2)
+	results <- runs.ExecutionRun{Type: runs.KubeletRun, Successful: true}
+	results <- runs.ExecutionRun{Type: runs.CrioRun, Error: "fake error"}
 
-	if expected, got := "/fakedir/kubelet-fakeid.pprof", h.kubeletPprofOutputFilePath("fakeid"); expected != got {
-		t.Errorf("Wrong kubelet output path, expected: %q, but got: %q", expected, got)
+	if _, _, err := h.stateLocker.Lock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uid := uuid.MustParse(validUID)
+	h.startRun(uid, 1)
+	h.processResults(uid, results, expected, 1)
+
+	w := httptest.NewRecorder()
+	h.metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/metrics", nil))
+	counters := map[string]float64{}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "node_observability_agent_runs_") {
+			continue
+		}
+		fields := strings.Fields(line)
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counters[fields[0]] = v
+	}
+	for _, rt := range expected {
+		label := `{type="` + string(rt) + `"}`
+		started := counters["node_observability_agent_runs_started_total"+label]
+		finished := counters["node_observability_agent_runs_completed_total"+label] +
+			counters["node_observability_agent_runs_failed_total"+label] +
+			counters["node_observability_agent_runs_cancelled_total"+label]
+		if started != 1 || finished != started {
+			t.Errorf("expected the %s run started and finished once, but was started %v and finished %v times", rt, started, finished)
+		}
 	}
+	if failed := counters[`node_observability_agent_runs_failed_total{type="System"}`]; failed != 1 {
+		t.Errorf("expected the system run in timeout counted as failed but was %v", failed)
+	}
+	if _, ok := counters[`node_observability_agent_runs_failed_total{type="Unknown"}`]; ok {
+		t.Error("expected no Unknown run")
+	}
+}
+
+func TestOutputFilePaths(t *testing.T) {
+	h := Handlers{StorageFolder: "/fakedir"}
 
 	if expected, got := fmt.Sprintf("/fakedir/%s.log", validUID), h.runLogOutputFilePath(runs.Run{ID: uuid.MustParse(validUID)}); expected != got {
 		t.Errorf("Wrong log output path, expected: %q, but got: %q", expected, got)
@@ -482,12 +528,8 @@ func TestHandleScripting(t *testing.T) {
 
 	// cover the pass scenario
 	t.Run("ScriptingHandlers : should pass", func(t *testing.T) {
-		h := &Handlers{
-			NodeIP:        "TEST",
-			StorageFolder: "/tmp",
-			Connector:     &connectors.FakeConnector{Flag: ""},
-		}
-		h.stateLocker = statelocker.NewStateLock(h.errorOutputFilePath())
+		h := NewScriptingHandlers("/tmp", "TEST")
+		h.Connector = &connectors.FakeConnector{Flag: ""}
 
 		r := httptest.NewRequest("GET", "http://localhost/node-observability-scripting", nil)
 		w := httptest.NewRecorder()
@@ -558,12 +600,8 @@ func TestHandleScripting(t *testing.T) {
 
 	// cover the fail scenario
 	t.Run("ScriptingHandlers : should fail", func(t *testing.T) {
-		h := &Handlers{
-			NodeIP:        "TEST",
-			StorageFolder: "/tmp",
-			Connector:     &connectors.FakeConnector{Flag: connectors.ScriptErr},
-		}
-		h.stateLocker = statelocker.NewStateLock(h.errorOutputFilePath())
+		h := NewScriptingHandlers("/tmp", "TEST")
+		h.Connector = &connectors.FakeConnector{Flag: connectors.ScriptErr}
 
 		r := httptest.NewRequest("GET", "http://localhost/node-observability-scripting", nil)
 		w := httptest.NewRecorder()
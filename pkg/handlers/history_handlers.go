@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/history"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+const (
+	defaultRunListLimit = 50
+	maxRunListLimit     = 500
+)
+
+// ListRuns is called when the agent receives an HTTP request on endpoint /runs.
+// It returns the runs of the history, newest first, as a history.RunList.
+// The optional query parameters are:
+// * type: only returns the runs having an execution run of this type,
+// * successful: true or false, only returns the successful or failed runs,
+// * since, until: RFC3339 times bounding the begin time of the runs,
+// * offset, limit: paging of the runs, 50 runs are returned by default.
+func (h *Handlers) ListRuns(w http.ResponseWriter, r *http.Request) {
+	filter, offset, limit, err := parseRunListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.history.List(filter, offset, limit)
+	if err != nil {
+		http.Error(w, "error reading the run history", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	if err := sendJSON(w, list); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// GetRun is called when the agent receives an HTTP request on endpoint /runs/{id}.
+// It returns the runs.Run of the given ID, HTTP 404 if it's not part of the history.
+func (h *Handlers) GetRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	run, err := h.history.Get(id)
+	if errors.Is(err, history.ErrRunNotFound) {
+		http.Error(w, fmt.Sprintf("run %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error reading the run history", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	if err := sendJSON(w, run); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// parseRunListQuery returns the filter and paging parameters from the query of a ListRuns request.
+func parseRunListQuery(query url.Values) (history.Filter, int, int, error) {
+	filter := history.Filter{
+		Type: runs.RunType(query.Get("type")),
+	}
+	if s := query.Get("successful"); s != "" {
+		successful, err := strconv.ParseBool(s)
+		if err != nil {
+			return filter, 0, 0, fmt.Errorf("invalid successful parameter %q", s)
+		}
+		filter.Successful = &successful
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(query, "since"); err != nil {
+		return filter, 0, 0, err
+	}
+	if filter.Until, err = parseTimeParam(query, "until"); err != nil {
+		return filter, 0, 0, err
+	}
+
+	offset, err := parseIntParam(query, "offset", 0, 0, -1)
+	if err != nil {
+		return filter, 0, 0, err
+	}
+	limit, err := parseIntParam(query, "limit", defaultRunListLimit, 1, maxRunListLimit)
+	if err != nil {
+		return filter, 0, 0, err
+	}
+	return filter, offset, limit, nil
+}
+
+// parseTimeParam returns the RFC3339 time of the given query parameter, or the zero time if missing.
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	s := query.Get(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s parameter %q, expecting an RFC3339 time", name, s)
+	}
+	return t, nil
+}
+
+// parseIntParam returns the integer of the given query parameter, or def if missing.
+// The value must be at least min, and at most max unless max is negative.
+func parseIntParam(query url.Values, name string, def, min, max int) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < min || (max >= 0 && i > max) {
+		return 0, fmt.Errorf("invalid %s parameter %q", name, s)
+	}
+	return i, nil
+}
+
+// sendJSON sends the given value as a JSON HTTP response.
+func sendJSON(w http.ResponseWriter, v interface{}) error {
+	jsResponse, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return fmt.Errorf("unable to marshal response: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(jsResponse); err != nil {
+		return fmt.Errorf("unable to send HTTP response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/history"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+func TestRunHistory(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handlers{StorageFolder: dir, history: history.NewStore(dir)}
+	run := runs.Run{
+		ID: uuid.MustParse(validUID),
+		ExecutionRuns: []runs.ExecutionRun{
+			{
+				Type:      runs.KubeletRun,
+				BeginTime: time.Now(),
+				EndTime:   time.Now(),
+				Error:     "fake error",
+			},
+		},
+	}
+	if err := writeRunToFile(run, h.runLogOutputFilePath(run)); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/node-observability-runs", h.ListRuns)
+	router.HandleFunc("/node-observability-runs/{id}", h.GetRun)
+
+	testCases := []struct {
+		name          string
+		url           string
+		expectedCode  int
+		expectedTotal int
+	}{
+		{
+			name:          "List all runs",
+			url:           "/node-observability-runs",
+			expectedCode:  http.StatusOK,
+			expectedTotal: 1,
+		},
+		{
+			name:          "List failed kubelet runs",
+			url:           "/node-observability-runs?type=Kubelet&successful=false&since=2022-03-03T10:00:00Z",
+			expectedCode:  http.StatusOK,
+			expectedTotal: 1,
+		},
+		{
+			name:          "List successful runs",
+			url:           "/node-observability-runs?successful=true",
+			expectedCode:  http.StatusOK,
+			expectedTotal: 0,
+		},
+		{
+			name:         "Invalid limit",
+			url:          "/node-observability-runs?limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid time",
+			url:          "/node-observability-runs?since=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Get run in error",
+			url:          "/node-observability-runs/" + validUID,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get unknown run",
+			url:          "/node-observability-runs/" + uuid.NewString(),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Get invalid run ID",
+			url:          "/node-observability-runs/notAnID",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost"+tc.url, nil))
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.expectedCode {
+				t.Fatalf("expected status code %d but was %d", tc.expectedCode, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.url == "/node-observability-runs/"+validUID {
+				got := runs.Run{}
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatal(err)
+				}
+				if got.ID != run.ID || got.ExecutionRuns[0].Error != "fake error" {
+					t.Errorf("expected run %v but got %v", run, got)
+				}
+				return
+			}
+			list := history.RunList{}
+			if err := json.Unmarshal(body, &list); err != nil {
+				t.Fatal(err)
+			}
+			if list.Total != tc.expectedTotal {
+				t.Errorf("expected %d runs but got %d", tc.expectedTotal, list.Total)
+			}
+		})
+	}
+}
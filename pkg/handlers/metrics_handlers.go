@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+// scriptCollectorName is the collector name of the script in the metrics
+const scriptCollectorName = "script"
+
+// Metrics is called when the agent receives an HTTP request on endpoint /metrics.
+// It returns the prometheus metrics of the agent.
+func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
+	h.metrics.Handler().ServeHTTP(w, r)
+}
+
+// metricsState returns the state of the agent, statelocker.Queued while runs wait for the
+// ongoing one, and when in error, the end time of the run in error which is the time the error occurred.
+func (h *Handlers) metricsState() (statelocker.State, time.Time) {
+	id, state, err := h.stateLocker.LockInfo()
+	if err == nil && state == statelocker.Taken && len(h.queueStatus()) > 0 {
+		return statelocker.Queued, time.Time{}
+	}
+	if err != nil || state != statelocker.InError {
+		return state, time.Time{}
+	}
+	arun, err := h.history.Get(id)
+	if err != nil {
+		return state, time.Time{}
+	}
+	return state, arun.EndTime()
+}
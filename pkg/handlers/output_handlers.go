@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/connectors"
+)
+
+const (
+	// outputPollInterval is the interval at which the output files of a running script are read
+	outputPollInterval = 500 * time.Millisecond
+	// maxEventBytes is the size of the longest line sent as a single Server-Sent Event,
+	// the longer lines are split so that they aren't buffered whole
+	maxEventBytes = connectors.MaxBufferedOutput
+)
+
+// StreamOutput is called when the agent receives an HTTP GET request on endpoint /runs/{id}/output.
+// It sends the stdout, or the stderr with ?stream=stderr, of the script of the run from the start of
+// the output file, and follows it until the end of the run. The output is sent as chunked text, or as
+// Server-Sent Events if the client accepts text/event-stream. It returns:
+// * HTTP 400 if the stream or the offset are invalid,
+// * HTTP 404 if the run is neither running nor has output,
+// * HTTP 200 with the output otherwise.
+func (h *Handlers) StreamOutput(w http.ResponseWriter, r *http.Request) {
+	id, ok := runIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	ext := r.URL.Query().Get("stream")
+	if ext == "" {
+		ext = stdoutFileExt
+	}
+	if ext != stdoutFileExt && ext != stderrFileExt {
+		http.Error(w, fmt.Sprintf("invalid stream %q, expected %s or %s", ext, stdoutFileExt, stderrFileExt), http.StatusBadRequest)
+		return
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	offsetParam := r.URL.Query().Get("offset")
+	if sse && r.Header.Get("Last-Event-ID") != "" {
+		offsetParam = r.Header.Get("Last-Event-ID")
+	}
+	var offset int64
+	if offsetParam != "" {
+		var err error
+		offset, err = strconv.ParseInt(offsetParam, 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, fmt.Sprintf("invalid offset %q", offsetParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// done is nil if the run is over, the file is then read once to its end
+	done := h.runDone(id)
+	f, err := h.openOutput(r, id, ext, done)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("no %s found for run %s", ext, id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error reading script output", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		http.Error(w, "error reading script output", http.StatusInternalServerError)
+		hlog.Error(err)
+		return
+	}
+
+	var out outputWriter = &textOutput{w: w}
+	if sse {
+		out = &sseOutput{w: w, offset: offset}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	if err := followOutput(r, f, out, done); err != nil {
+		// the response is already being sent, the client gets a truncated output
+		hlog.Errorf("unable to stream the %s of run %s: %v", ext, id, err)
+	}
+}
+
+// openOutput opens the output file of the run, waiting for the running script to create it.
+func (h *Handlers) openOutput(r *http.Request, id uuid.UUID, ext string, done <-chan struct{}) (*os.File, error) {
+	path := h.outputFilePath(scriptOutputPrefix, id.String(), ext)
+	ticker := time.NewTicker(outputPollInterval)
+	defer ticker.Stop()
+	for {
+		f, err := os.Open(path)
+		if !errors.Is(err, fs.ErrNotExist) || done == nil {
+			return f, err
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			done = nil
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+// followOutput sends the contents of f to out, and waits for more until done is
+// closed, or until the client goes away. done is nil if the script is over.
+// The output is followed for as long as the script runs: instead of bounding the whole
+// response, the write timeout of the server bounds each write.
+func followOutput(r *http.Request, f *os.File, out outputWriter, done <-chan struct{}) error {
+	ticker := time.NewTicker(outputPollInterval)
+	defer ticker.Stop()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			extendWriteDeadline(r)
+			if err := out.write(buf[:n]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if done == nil {
+			extendWriteDeadline(r)
+			return out.end()
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			// the file is read to its end once more
+			done = nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// runDone returns the channel closed at the end of the run of the given ID, nil if it's not in progress.
+func (h *Handlers) runDone(id uuid.UUID) <-chan struct{} {
+	h.inflightMux.Lock()
+	defer h.inflightMux.Unlock()
+	run, ok := h.inflight[id]
+	if !ok {
+		return nil
+	}
+	return run.done
+}
+
+// outputWriter sends the output of a script to the client
+type outputWriter interface {
+	write(p []byte) error
+	// end is called once the whole output is sent
+	end() error
+}
+
+// textOutput sends the output as is
+type textOutput struct {
+	w http.ResponseWriter
+}
+
+func (o *textOutput) write(p []byte) error {
+	if _, err := o.w.Write(p); err != nil {
+		return err
+	}
+	flush(o.w)
+	return nil
+}
+
+func (o *textOutput) end() error {
+	return nil
+}
+
+// sseOutput sends each line of the output as a Server-Sent Event, its ID being the offset
+// of the end of the line, so that reconnecting clients resume with Last-Event-ID.
+type sseOutput struct {
+	w      http.ResponseWriter
+	offset int64
+	// partial holds the last line, until its end is read or it reaches maxEventBytes
+	partial []byte
+}
+
+func (o *sseOutput) write(p []byte) error {
+	o.partial = append(o.partial, p...)
+	for {
+		i := bytes.IndexByte(o.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if err := o.send(o.partial[:i], int64(i+1)); err != nil {
+			return err
+		}
+		o.partial = o.partial[i+1:]
+	}
+	for len(o.partial) >= maxEventBytes {
+		if err := o.send(o.partial[:maxEventBytes], maxEventBytes); err != nil {
+			return err
+		}
+		o.partial = o.partial[maxEventBytes:]
+	}
+	return nil
+}
+
+func (o *sseOutput) end() error {
+	if len(o.partial) > 0 {
+		if err := o.send(o.partial, int64(len(o.partial))); err != nil {
+			return err
+		}
+	}
+	// the end event tells the clients not to reconnect
+	if _, err := io.WriteString(o.w, "event: end\ndata:\n\n"); err != nil {
+		return err
+	}
+	flush(o.w)
+	return nil
+}
+
+func (o *sseOutput) send(line []byte, size int64) error {
+	o.offset += size
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if _, err := fmt.Fprintf(o.w, "id: %d\n", o.offset); err != nil {
+		return err
+	}
+	// a carriage return ends the data of an event, such as the ones redrawing progress bars:
+	// the parts of the line are sent as data lines of the same event, joined by a line feed by the clients
+	for _, part := range bytes.Split(line, []byte("\r")) {
+		if _, err := fmt.Fprintf(o.w, "data: %s\n", part); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(o.w, "\n"); err != nil {
+		return err
+	}
+	flush(o.w)
+	return nil
+}
+
+// flush sends the buffered data to the client
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
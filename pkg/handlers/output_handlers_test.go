@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/connectors"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+func TestStreamOutput(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.Connector = &connectors.Connector{}
+	router := mux.NewRouter()
+	router.HandleFunc("/node-observability-runs/{id}/output", h.StreamOutput)
+
+	// the output of a finished run is replayed
+	if err := os.WriteFile(filepath.Join(h.StorageFolder, "script-"+validUID+".stdout"), []byte("one\ntwo\nthree"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(h.StorageFolder, "script-"+validUID+".stderr"), []byte("failed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		url          string
+		headers      map[string]string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "stdout",
+			url:          "/node-observability-runs/" + validUID + "/output",
+			expectedCode: http.StatusOK,
+			expectedBody: "one\ntwo\nthree",
+		},
+		{
+			name:         "stderr",
+			url:          "/node-observability-runs/" + validUID + "/output?stream=stderr",
+			expectedCode: http.StatusOK,
+			expectedBody: "failed\n",
+		},
+		{
+			name:         "offset",
+			url:          "/node-observability-runs/" + validUID + "/output?offset=4",
+			expectedCode: http.StatusOK,
+			expectedBody: "two\nthree",
+		},
+		{
+			name:         "server-sent events",
+			url:          "/node-observability-runs/" + validUID + "/output",
+			headers:      map[string]string{"Accept": "text/event-stream"},
+			expectedCode: http.StatusOK,
+			expectedBody: "id: 4\ndata: one\n\nid: 8\ndata: two\n\nid: 13\ndata: three\n\nevent: end\ndata:\n\n",
+		},
+		{
+			name:         "server-sent events resumed",
+			url:          "/node-observability-runs/" + validUID + "/output",
+			headers:      map[string]string{"Accept": "text/event-stream", "Last-Event-ID": "8"},
+			expectedCode: http.StatusOK,
+			expectedBody: "id: 13\ndata: three\n\nevent: end\ndata:\n\n",
+		},
+		{
+			name:         "invalid stream",
+			url:          "/node-observability-runs/" + validUID + "/output?stream=agent.err",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid offset",
+			url:          "/node-observability-runs/" + validUID + "/output?offset=-1",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown run",
+			url:          "/node-observability-runs/0f8fad5b-d9cb-469f-a165-70867728950e/output",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+tc.url, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tc.expectedCode {
+				t.Fatalf("expected status code %d but was %d: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+			if tc.expectedBody != "" && w.Body.String() != tc.expectedBody {
+				t.Errorf("expected body %q but got %q", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("output of a running script", func(t *testing.T) {
+		t.Setenv("EXECUTE_SCRIPT", "echo one; sleep 1; echo two")
+		w := httptest.NewRecorder()
+		h.HandleScripting(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-scripting", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d but was %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var arun runs.Run
+		if err := json.Unmarshal(w.Body.Bytes(), &arun); err != nil {
+			t.Fatal(err)
+		}
+
+		begin := time.Now()
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost/node-observability-runs/"+arun.ID.String()+"/output", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "one\ntwo\n" {
+			t.Errorf("expected the whole output but got %d: %q", w.Code, w.Body.String())
+		}
+		if elapsed := time.Since(begin); elapsed < 500*time.Millisecond {
+			t.Errorf("expected the output to be followed until the end of the script, but returned after %v", elapsed)
+		}
+	})
+}
+
+func TestStreamOutputWriteDeadline(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	router := mux.NewRouter()
+	router.Use(WriteDeadline(300 * time.Millisecond))
+	router.HandleFunc("/node-observability-scripting", h.HandleScripting)
+	router.HandleFunc("/node-observability-runs/{id}/output", h.StreamOutput)
+	// a response taking longer than the write timeout is cut
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "one\n")
+		flush(w)
+		time.Sleep(time.Second)
+		_, _ = io.WriteString(w, "two\n")
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/slow"); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) == "one\ntwo\n" {
+			t.Fatal("expected the slow response to be cut by the write deadline")
+		}
+	}
+
+	t.Setenv("EXECUTE_SCRIPT", "echo one; sleep 1; echo two")
+	resp, err := http.Get(server.URL + "/node-observability-scripting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var arun runs.Run
+	err = json.NewDecoder(resp.Body).Decode(&arun)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.Get(server.URL + "/node-observability-runs/" + arun.ID.String() + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "one\ntwo\n" {
+		t.Errorf("expected the whole output, followed past the write timeout, but got %q: %v", body, err)
+	}
+}
+
+func TestSSEOutputLongLine(t *testing.T) {
+	w := httptest.NewRecorder()
+	out := &sseOutput{w: w}
+	// a line of 2.5 events, without its end
+	line := bytes.Repeat([]byte("a"), 5*maxEventBytes/2)
+	if err := out.write(line); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.partial) != maxEventBytes/2 {
+		t.Errorf("expected %d bytes buffered but got %d", maxEventBytes/2, len(out.partial))
+	}
+	if err := out.write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events but got %d", len(events))
+	}
+	for i, expectedID := range []int{maxEventBytes, 2 * maxEventBytes, 5*maxEventBytes/2 + 1} {
+		if !strings.HasPrefix(events[i], "id: "+strconv.Itoa(expectedID)+"\n") {
+			t.Errorf("expected event %d to have ID %d but got %.20q", i, expectedID, events[i])
+		}
+	}
+}
+
+func TestSSEOutputCarriageReturn(t *testing.T) {
+	w := httptest.NewRecorder()
+	out := &sseOutput{w: w}
+	if err := out.write([]byte("10%\r50%\r100%\r\ndone\n")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id: 14\ndata: 10%\ndata: 50%\ndata: 100%\n\nid: 19\ndata: done\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected %q but got %q", expected, w.Body.String())
+	}
+}
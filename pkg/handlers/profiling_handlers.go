@@ -1,138 +1,179 @@
 package handlers
 
 import (
-	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"io"
 	"net/http"
-	"net/url"
 	"time"
 
-	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/collectors"
 )
 
 const (
-	defaultCrioHost    = "localhost"
-	defaultCrioPort    = "6060"
-	defaultKubeletPort = "10250"
-	crioProfilePath    = "debug/pprof/profile"
-	kubeletProfilePath = "debug/pprof/profile"
+	maxRequestSize = 1 << 20
+	// defaultProfilingSeconds is the CPU profile duration used when the request doesn't set one,
+	// it matches the default of the pprof endpoints
+	defaultProfilingSeconds = 30
+	maxProfilingSeconds     = 600
+	// profilingTimeoutMargin is added to the profiling duration to give the targets time to answer
+	profilingTimeoutMargin = 5
+	maxResolutionSeconds   = 60
 )
 
-// profileCrio triggers CRIO profiling on localhost.
-func (h *Handlers) profileCrio(uid string) runs.ExecutionRun {
-	client := &http.Client{
-		Transport: newDefaultHTTPTransport().build(),
-	}
-	if h.CrioPreferUnixSocket {
-		client.Transport = newDefaultHTTPTransport().withUnixDialContext(h.CrioUnixSocket).build()
-	}
-
-	u := url.URL{
-		Scheme: "http",
-		Host:   net.JoinHostPort(defaultCrioHost, defaultCrioPort),
-		Path:   crioProfilePath,
-	}
-
-	hlog.Infof("requesting CRIO profiling, runID: %s", uid)
-	return sendHTTPProfileRequest(runs.CrioRun, "GET", u.String(), "", h.crioPprofOutputFilePath(uid), client)
+// ProfilingRequest holds the optional parameters of a request on endpoint /pprof.
+// An empty request collects the CPU profile of every target.
+type ProfilingRequest struct {
+	// Profiles maps a target (kubelet, crio or a configured target) to the profile types to collect from it.
+	// Targets missing from the map are not profiled.
+	Profiles map[string][]collectors.ProfileType
+	// Seconds is the duration of the CPU profiles and execution traces, passed as seconds= to the pprof endpoints.
+	// Defaults to defaultProfilingSeconds.
+	Seconds int
+	// Samplers are the native samplers (system, network, processes, pods) run for the same duration.
+	// The CPU profiles of every target are only collected by default if no sampler is requested,
+	// the kubelet and CRIO processes are sampled along with their profiles.
+	Samplers []string
+	// ResolutionSeconds is the interval between two samples, defaults to 5 seconds
+	ResolutionSeconds int
 }
 
-// profileKubelet triggers Kubelet profiling on h.NodeIP using h.Token for authorization.
-func (h *Handlers) profileKubelet(uid string) runs.ExecutionRun {
-	client := &http.Client{
-		Transport: newDefaultHTTPTransport().withRootCAs(h.CACerts).build(),
-	}
-
-	u := url.URL{
-		Scheme: "https",
-		Host:   net.JoinHostPort(h.NodeIP, defaultKubeletPort),
-		Path:   kubeletProfilePath,
-	}
-
-	hlog.Infof("requesting Kubelet profiling, runID: %s", uid)
-	return sendHTTPProfileRequest(runs.KubeletRun, "GET", u.String(), h.Token, h.kubeletPprofOutputFilePath(uid), client)
+// timeout returns the number of seconds to wait for the profilings of the request to finish.
+func (p ProfilingRequest) timeout() int {
+	return p.Seconds + profilingTimeoutMargin
 }
 
-// sendHTTPProfileRequest sends the http request to the given url,
-// writes the response down to the given output and returns the profiling run instance.
-func sendHTTPProfileRequest(rtype runs.RunType, method, url, token, outputPath string, client *http.Client) runs.ExecutionRun {
-	run := runs.ExecutionRun{
-		Type:      rtype,
-		BeginTime: time.Now(),
+// params returns the parameters from which the collectors of the request are built.
+func (p ProfilingRequest) params() collectors.Params {
+	return collectors.Params{
+		Profiles:   p.Profiles,
+		Seconds:    p.Seconds,
+		Samplers:   p.Samplers,
+		Resolution: time.Duration(p.ResolutionSeconds) * time.Second,
 	}
+}
 
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		run.EndTime = time.Now()
-		run.Error = fmt.Sprintf("failed to create http request: %v", err)
-		return run
+// RegisterPprofTargets registers the given pprof targets as data sources of the profiling mode.
+func (h *Handlers) RegisterPprofTargets(targets ...*collectors.PprofTarget) error {
+	for _, t := range targets {
+		if err := h.registry.Register(t.Name, t.Factory()); err != nil {
+			return err
+		}
+		h.pprofTargets = append(h.pprofTargets, t.Name)
 	}
+	return nil
+}
 
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
+// RegisterSamplers registers the system, network, process and pod samplers, reading the host filesystems
+// mounted at the given roots, as data sources of the profiling mode.
+func (h *Handlers) RegisterSamplers(roots collectors.Roots) error {
+	proc := roots.ProcFS()
+	if err := h.registerSampler(collectors.SystemSampler, collectors.NewSystemSamplerFactory(proc)); err != nil {
+		return err
 	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		run.EndTime = time.Now()
-		run.Error = fmt.Sprintf("failed sending profiling request: %v", err)
-		return run
+	if err := h.registerSampler(collectors.NetworkSampler, collectors.NewNetworkSamplerFactory(proc)); err != nil {
+		return err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		run.EndTime = time.Now()
-		run.Error = fmt.Sprintf("error status code received: %d", res.StatusCode)
-		return run
+	if err := h.registerSampler(collectors.ProcessSampler, collectors.NewProcessSamplerFactory(proc)); err != nil {
+		return err
 	}
+	return h.registerSampler(collectors.PodSampler, collectors.NewPodSamplerFactory(roots.CgroupFS()))
+}
 
-	if err := writeToFile(res.Body, outputPath); err != nil {
-		run.EndTime = time.Now()
-		run.Error = fmt.Sprintf("failed writing profiling data into file: %v", err)
-		return run
+// registerSampler registers the factory of a native sampler as a data source of the profiling mode.
+func (h *Handlers) registerSampler(name string, factory collectors.Factory) error {
+	if err := h.registry.Register(name, factory); err != nil {
+		return err
 	}
-
-	run.EndTime = time.Now()
-	run.Successful = true
-
-	return run
+	h.samplers = append(h.samplers, name)
+	return nil
 }
 
-type httpTransportBuilder struct {
-	tlsClientConfig *tls.Config
-	dialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+// isSampler returns true if a native sampler is registered under the given name.
+func (h *Handlers) isSampler(name string) bool {
+	for _, sampler := range h.samplers {
+		if sampler == name {
+			return true
+		}
+	}
+	return false
 }
 
-func newDefaultHTTPTransport() *httpTransportBuilder {
-	return &httpTransportBuilder{
-		dialContext: (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+// defaultProfilingRequest returns the request used when the client didn't send any parameter.
+func (h *Handlers) defaultProfilingRequest() ProfilingRequest {
+	preq := ProfilingRequest{
+		Profiles: map[string][]collectors.ProfileType{},
+		Seconds:  defaultProfilingSeconds,
+	}
+	for _, target := range h.pprofTargets {
+		preq.Profiles[target] = []collectors.ProfileType{collectors.CPUProfile}
 	}
+	return preq
 }
 
-func (b *httpTransportBuilder) withRootCAs(certs *x509.CertPool) *httpTransportBuilder {
-	b.tlsClientConfig = &tls.Config{RootCAs: certs, MinVersion: tls.VersionTLS12}
-	return b
+// isPprofTarget returns true if a pprof target is registered under the given name.
+func (h *Handlers) isPprofTarget(name string) bool {
+	for _, target := range h.pprofTargets {
+		if target == name {
+			return true
+		}
+	}
+	return false
 }
 
-func (b *httpTransportBuilder) withUnixDialContext(socket string) *httpTransportBuilder {
-	b.dialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
-		return (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext(ctx, "unix", socket)
+// parseProfilingRequest decodes the optional JSON body of a profiling request
+// and checks that it only refers to known targets and profile types.
+func (h *Handlers) parseProfilingRequest(r *http.Request) (ProfilingRequest, error) {
+	preq := ProfilingRequest{}
+	if r.Body != nil {
+		decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&preq); err != nil && !errors.Is(err, io.EOF) {
+			return preq, fmt.Errorf("unable to decode profiling request: %w", err)
+		}
+	}
+	if preq.Seconds < 0 || preq.Seconds > maxProfilingSeconds {
+		return preq, fmt.Errorf("profiling duration must be between 1 and %d seconds, got %d", maxProfilingSeconds, preq.Seconds)
+	}
+	if preq.Seconds == 0 {
+		preq.Seconds = defaultProfilingSeconds
+	}
+	if preq.ResolutionSeconds < 0 || preq.ResolutionSeconds > maxResolutionSeconds || preq.ResolutionSeconds > preq.Seconds {
+		return preq, fmt.Errorf("sampling resolution must be between 1 and %d seconds, and at most the duration, got %d", maxResolutionSeconds, preq.ResolutionSeconds)
+	}
+	seenSamplers := map[string]bool{}
+	for _, sampler := range preq.Samplers {
+		if !h.isSampler(sampler) {
+			return preq, fmt.Errorf("unknown sampler %q", sampler)
+		}
+		if seenSamplers[sampler] {
+			return preq, fmt.Errorf("sampler %q requested more than once", sampler)
+		}
+		seenSamplers[sampler] = true
+	}
+	if len(preq.Profiles) == 0 && len(preq.Samplers) == 0 {
+		preq.Profiles = h.defaultProfilingRequest().Profiles
+		return preq, nil
 	}
-	return b
-}
 
-func (b *httpTransportBuilder) build() *http.Transport {
-	return &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           b.dialContext,
-		TLSClientConfig:       b.tlsClientConfig,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+	for target, profiles := range preq.Profiles {
+		if !h.isPprofTarget(target) {
+			return preq, fmt.Errorf("unknown profiling target %q", target)
+		}
+		if len(profiles) == 0 {
+			return preq, fmt.Errorf("no profile type requested for target %q", target)
+		}
+		seen := map[collectors.ProfileType]bool{}
+		for _, p := range profiles {
+			if !p.IsValid() {
+				return preq, fmt.Errorf("unknown profile type %q for target %q", p, target)
+			}
+			if seen[p] {
+				return preq, fmt.Errorf("profile type %q requested more than once for target %q", p, target)
+			}
+			seen[p] = true
+		}
 	}
+	return preq, nil
 }
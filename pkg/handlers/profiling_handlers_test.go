@@ -1,147 +1,190 @@
 package handlers
 
 import (
-	"bytes"
-	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
-	"regexp"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
-
+	"github.com/openshift/node-observability-agent/pkg/collectors"
 	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
 )
 
-const (
-	fakeMethod     = "get"
-	fakeURL        = "http://fakehost:8080/debug"
-	fakeToken      = ""
-	fakeOutputFile = "fakefile"
-)
-
-func TestSendHTTPProfileRequest(t *testing.T) {
+func TestParseProfilingRequest(t *testing.T) {
+	h := NewHandlers("abc", makeCACertPool(), "/tmp", "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
+	if err := h.RegisterSamplers(collectors.Roots{Proc: testProcRoot, Sys: "../../test_resources/host/sys"}); err != nil {
+		t.Fatalf("unable to register the samplers: %v", err)
+	}
 	testCases := []struct {
 		name             string
-		client           *http.Client
-		expectedRun      runs.ExecutionRun
-		expectedContents string
+		body             string
+		expectedProfiles map[string][]collectors.ProfileType
+		expectedSeconds  int
+		expectedError    bool
 	}{
 		{
-			name: "Nominal",
-			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
-				return newTestResponse("OK", nil, http.StatusOK), nil
-			}),
-			expectedRun: runs.ExecutionRun{
-				Type:       runs.KubeletRun,
-				Successful: true,
-				Error:      "",
-			},
-			expectedContents: "OK",
+			name:             "Empty body, CPU profiling of all targets",
+			body:             "",
+			expectedProfiles: h.defaultProfilingRequest().Profiles,
+			expectedSeconds:  defaultProfilingSeconds,
 		},
 		{
-			name: "HTTP query error",
-			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
-				return newTestResponse("", nil, http.StatusUnauthorized), fmt.Errorf("fake error")
-			}),
-			expectedRun: runs.ExecutionRun{
-				Type:       runs.KubeletRun,
-				Successful: false,
-				Error:      fmt.Sprintf("failed sending profiling request: %s %q: fake error", cases.Title(language.Und).String(fakeMethod), fakeURL),
-			},
+			name:             "Empty profiles, CPU profiling of all targets",
+			body:             `{"Profiles":{}}`,
+			expectedProfiles: h.defaultProfilingRequest().Profiles,
+			expectedSeconds:  defaultProfilingSeconds,
 		},
 		{
-			name: "HTTP response status not OK",
-			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
-				return newTestResponse("", nil, http.StatusUnauthorized), nil
-			}),
-			expectedRun: runs.ExecutionRun{
-				Type:       runs.KubeletRun,
-				Successful: false,
-				Error:      "error status code received: 401",
+			name:             "Quick CPU profiling of all targets",
+			body:             `{"Seconds":5}`,
+			expectedProfiles: h.defaultProfilingRequest().Profiles,
+			expectedSeconds:  5,
+		},
+		{
+			name: "Several profile types for kubelet only",
+			body: `{"Profiles":{"kubelet":["heap","goroutine","profile"]}}`,
+			expectedProfiles: map[string][]collectors.ProfileType{
+				collectors.KubeletTarget: {collectors.HeapProfile, collectors.GoroutineProfile, collectors.CPUProfile},
 			},
+			expectedSeconds: defaultProfilingSeconds,
+		},
+		{
+			name:            "System and network sampling only, no CPU profiling",
+			body:            `{"Samplers":["system","network"],"ResolutionSeconds":1,"Seconds":10}`,
+			expectedSeconds: 10,
 		},
 		{
-			name: "Write to file failed",
-			client: newHTTPTestClient(func(req *http.Request) (*http.Response, error) {
-				return newTestResponse("OK", fmt.Errorf("fake error"), http.StatusOK), nil
-			}),
-			expectedRun: runs.ExecutionRun{
-				Type:       runs.KubeletRun,
-				Successful: false,
-				Error:      fmt.Sprintf("failed writing profiling data into file: failed to write to file .+/%s: fake error", fakeOutputFile),
+			name: "System sampling along with a heap profile",
+			body: `{"Samplers":["system"],"Profiles":{"crio":["heap"]}}`,
+			expectedProfiles: map[string][]collectors.ProfileType{
+				collectors.CrioTarget: {collectors.HeapProfile},
 			},
+			expectedSeconds: defaultProfilingSeconds,
+		},
+		{
+			name:          "Unknown sampler, error",
+			body:          `{"Samplers":["pidstat"]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Duplicated sampler, error",
+			body:          `{"Samplers":["system","system"]}`,
+			expectedError: true,
+		},
+		{
+			name:          "Resolution longer than the duration, error",
+			body:          `{"Samplers":["system"],"ResolutionSeconds":20,"Seconds":10}`,
+			expectedError: true,
+		},
+		{
+			name:          "Resolution too long, error",
+			body:          `{"Samplers":["system"],"ResolutionSeconds":120,"Seconds":600}`,
+			expectedError: true,
+		},
+		{
+			name:          "Negative duration, error",
+			body:          `{"Seconds":-1}`,
+			expectedError: true,
+		},
+		{
+			name:          "Duration too long, error",
+			body:          `{"Seconds":3600}`,
+			expectedError: true,
+		},
+		{
+			name:          "Unknown target, error",
+			body:          `{"Profiles":{"etcd":["heap"]}}`,
+			expectedError: true,
+		},
+		{
+			name:          "Unknown profile type, error",
+			body:          `{"Profiles":{"crio":["cmdline"]}}`,
+			expectedError: true,
+		},
+		{
+			name:          "Duplicated profile type, error",
+			body:          `{"Profiles":{"crio":["heap","heap"]}}`,
+			expectedError: true,
+		},
+		{
+			name:          "Target without profile type, error",
+			body:          `{"Profiles":{"crio":[]}}`,
+			expectedError: true,
+		},
+		{
+			name:          "Unknown field, error",
+			body:          `{"Profile":{"crio":["heap"]}}`,
+			expectedError: true,
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			dir := t.TempDir()
-
-			pr := sendHTTPProfileRequest(runs.UnknownRun, strings.ToUpper(fakeMethod), fakeURL, fakeToken, dir+"/"+fakeOutputFile, tc.client)
-			if tc.expectedRun.Successful != pr.Successful {
-				t.Errorf("Expecting ProfilingRun successful to be %t but got %t", tc.expectedRun.Successful, pr.Successful)
+			r := httptest.NewRequest("POST", "http://localhost/node-observability-pprof", strings.NewReader(tc.body))
+			preq, err := h.parseProfilingRequest(r)
+			if tc.expectedError {
+				if err == nil {
+					t.Error("Expected error but didnt get any")
+				}
+				return
 			}
-			if matched, err := regexp.Match(tc.expectedRun.Error, []byte(pr.Error)); err != nil {
-				t.Errorf("Failed to match ProfilingRun error: %v", err)
-			} else if !matched {
-				t.Errorf("Expecting ProfilingRun error %q to match %q regexp", pr.Error, tc.expectedRun.Error)
+			if err != nil {
+				t.Fatalf("Did not expect error but got %v", err)
 			}
-			if pr.BeginTime.After(pr.EndTime) {
-				t.Errorf("Expecting begin time %v to be before the end time %v", pr.BeginTime, pr.EndTime)
+			if !reflect.DeepEqual(tc.expectedProfiles, preq.Profiles) {
+				t.Errorf("Expected profiles %v but got %v", tc.expectedProfiles, preq.Profiles)
 			}
-			if tc.expectedContents != "" {
-				if contents, err := os.ReadFile(dir + "/" + fakeOutputFile); err != nil {
-					t.Errorf("Failed to read the contents of kubelet pprof data: %v", err)
-				} else {
-					if tc.expectedContents != string(contents) {
-						t.Errorf("Expecting pprof contents: %q, but got %q", tc.expectedContents, string(contents))
-					}
-				}
+			if tc.expectedSeconds != preq.Seconds {
+				t.Errorf("Expected duration %ds but got %ds", tc.expectedSeconds, preq.Seconds)
+			}
+			if expected := tc.expectedSeconds + profilingTimeoutMargin; expected != preq.timeout() {
+				t.Errorf("Expected timeout %ds but got %ds", expected, preq.timeout())
 			}
 		})
 	}
 }
 
-type roundTripFunc func(req *http.Request) (*http.Response, error)
-
-func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
-	return f(req)
-}
-
-type testReadCloser struct {
-	*bytes.Reader
-	err error
-}
-
-func (r *testReadCloser) WriteTo(w io.Writer) (int64, error) {
-	// writeToFile uses io.Copy which in turn uses WriteTo method if it's present.
-	// Since we embed bytes.Reader, WriteTo is the one to be hooked up.
-	if r.err != nil {
-		return 0, r.err
+func TestProfilingSamplers(t *testing.T) {
+	storage := t.TempDir()
+	h := NewHandlers("abc", makeCACertPool(), storage, "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
+	if err := h.RegisterSamplers(collectors.Roots{Proc: testProcRoot}); err != nil {
+		t.Fatalf("unable to register the samplers: %v", err)
 	}
-	return r.Reader.WriteTo(w)
-}
-
-func (r *testReadCloser) Close() error {
-	return nil
-}
 
-func newHTTPTestClient(fn roundTripFunc) *http.Client {
-	return &http.Client{
-		Transport: roundTripFunc(fn),
+	r := httptest.NewRequest("POST", "http://localhost/node-observability-pprof", strings.NewReader(`{"Samplers":["system","network","processes","pods"],"Seconds":1,"ResolutionSeconds":1}`))
+	w := httptest.NewRecorder()
+	h.HandleProfiling(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d but was %d: %s", http.StatusOK, w.Code, w.Body.String())
 	}
-}
+	uid, _, _ := h.stateLocker.LockInfo()
 
-func newTestResponse(body string, err error, statusCode int) *http.Response {
-	return &http.Response{
-		Body: &testReadCloser{
-			Reader: bytes.NewReader([]byte(body)),
-			err:    err,
-		},
-		StatusCode: statusCode,
-		Header:     make(http.Header),
+	for i := 0; i < 50; i++ {
+		if _, s, _ := h.stateLocker.LockInfo(); s == statelocker.Free {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	run, err := h.history.Get(uid)
+	if err != nil {
+		t.Fatalf("run not found in history: %v", err)
+	}
+	types := map[runs.RunType]bool{}
+	for _, er := range run.ExecutionRuns {
+		if !er.Successful {
+			t.Errorf("expected successful %s run but got %q", er.Type, er.Error)
+		}
+		types[er.Type] = true
+	}
+	if len(run.ExecutionRuns) != 4 || !types[runs.SystemRun] || !types[runs.NetworkRun] || !types[runs.ProcessRun] || !types[runs.PodRun] {
+		t.Errorf("expected system, network, process and pod runs only, got %+v", run.ExecutionRuns)
+	}
+	for _, sampler := range []string{collectors.SystemSampler, collectors.NetworkSampler, collectors.ProcessSampler, collectors.PodSampler} {
+		if _, err := os.Stat(collectors.SamplesFilePath(storage, sampler, uid.String())); err != nil {
+			t.Errorf("expected the samples of %s: %v", sampler, err)
+		}
 	}
 }
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+// queuedRun is a run waiting for the ongoing run to finish
+type queuedRun struct {
+	id       uuid.UUID
+	queuedAt time.Time
+	// start launches the run once it holds the lock
+	start func(uuid.UUID)
+}
+
+// QueuedRunStatus is the status of a queued run
+type QueuedRunStatus struct {
+	RunID uuid.UUID
+	// Position is the position of the run in the queue, starting at 1
+	Position    int
+	WaitSeconds float64
+}
+
+// acquire takes the lock for a new run and starts it with start, or queues it
+// when the agent is busy and the queue has room, in which case the state is
+// statelocker.Queued and the returned ID is the one of the queued run.
+// The other states and errors are the ones of statelocker.StateLocker.Lock.
+func (h *Handlers) acquire(start func(uuid.UUID)) (uuid.UUID, statelocker.State, error) {
+	// the queue is locked while locking the state, so that the lock
+	// is always handed to the queued runs before the new ones
+	h.queueMux.Lock()
+	defer h.queueMux.Unlock()
+
+	uid, state, err := h.stateLocker.Lock()
+	if err != nil {
+		return uid, state, err
+	}
+	switch state {
+	case statelocker.Free:
+		start(uid)
+	case statelocker.Taken:
+		if len(h.queue) < h.QueueSize {
+			qr := queuedRun{
+				id:       uuid.New(),
+				queuedAt: time.Now(),
+				start:    start,
+			}
+			h.queue = append(h.queue, qr)
+			return qr.id, statelocker.Queued, nil
+		}
+	}
+	return uid, state, nil
+}
+
+// release frees the lock, and starts the next queued run.
+func (h *Handlers) release() {
+	h.queueMux.Lock()
+	defer h.queueMux.Unlock()
+	if err := h.stateLocker.Unlock(); err != nil {
+		hlog.Fatal(err)
+	}
+	h.startNext()
+}
+
+// clearError takes the agent out of the error state, see statelocker.StateLocker.ClearError,
+// and starts the next queued run.
+func (h *Handlers) clearError(archive func(runs.Run) error) (runs.Run, error) {
+	h.queueMux.Lock()
+	defer h.queueMux.Unlock()
+	arun, err := h.stateLocker.ClearError(archive)
+	if err != nil {
+		return arun, err
+	}
+	h.startNext()
+	return arun, nil
+}
+
+// startNext starts the first queued run if the lock is free. The queued
+// runs wait while the agent is in error. The queue must be locked.
+func (h *Handlers) startNext() {
+	if len(h.queue) == 0 {
+		return
+	}
+	next := h.queue[0]
+	uid, state, err := h.stateLocker.LockWithID(next.id)
+	if err != nil {
+		hlog.Errorf("unable to start queued run %s: %v", next.id, err)
+		return
+	}
+	if state != statelocker.Free {
+		hlog.Infof("agent is in state %s, queued run %s keeps waiting", state, next.id)
+		return
+	}
+	h.queue = h.queue[1:]
+	hlog.Infof("starting queued run %s after waiting %s", uid, time.Since(next.queuedAt))
+	next.start(uid)
+}
+
+// dequeue removes the queued run of the given ID,
+// and returns false if it is not in the queue.
+func (h *Handlers) dequeue(id uuid.UUID) bool {
+	h.queueMux.Lock()
+	defer h.queueMux.Unlock()
+	for i, qr := range h.queue {
+		if qr.id == id {
+			h.queue = append(h.queue[:i], h.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// queueStatus returns the status of the queued runs, in the order they will be run.
+func (h *Handlers) queueStatus() []QueuedRunStatus {
+	h.queueMux.Lock()
+	defer h.queueMux.Unlock()
+	status := make([]QueuedRunStatus, 0, len(h.queue))
+	for i, qr := range h.queue {
+		status = append(status, QueuedRunStatus{
+			RunID:       qr.id,
+			Position:    i + 1,
+			WaitSeconds: time.Since(qr.queuedAt).Seconds(),
+		})
+	}
+	return status
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/connectors"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestRunQueue(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.Connector = &connectors.FakeConnector{Flag: connectors.Blocking}
+	h.QueueSize = 2
+	router := mux.NewRouter()
+	router.HandleFunc("/node-observability-scripting", h.HandleScripting)
+	router.HandleFunc("/node-observability-status", h.Status)
+	router.HandleFunc("/node-observability-runs/{id}/cancel", h.CancelRun).Methods(http.MethodPost)
+
+	request := func(method, url string, expectedCode int) uuid.UUID {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "http://localhost"+url, nil))
+		if w.Code != expectedCode {
+			t.Fatalf("%s %s: expected status code %d but was %d: %s", method, url, expectedCode, w.Code, w.Body.String())
+		}
+		var arun runs.Run
+		_ = json.Unmarshal(w.Body.Bytes(), &arun)
+		return arun.ID
+	}
+	assertRunning := func(id uuid.UUID) {
+		t.Helper()
+		uid, s, err := h.stateLocker.LockInfo()
+		if err != nil || s != statelocker.Taken || uid != id {
+			t.Fatalf("expected run %s to be running, but state was %s for run %s: %v", id, s, uid, err)
+		}
+	}
+
+	first := request(http.MethodGet, "/node-observability-scripting", http.StatusOK)
+	second := request(http.MethodGet, "/node-observability-scripting", http.StatusAccepted)
+	third := request(http.MethodGet, "/node-observability-scripting", http.StatusAccepted)
+	// the queue is full
+	request(http.MethodGet, "/node-observability-scripting", http.StatusConflict)
+	assertRunning(first)
+	if s, _ := h.metricsState(); s != statelocker.Queued {
+		t.Errorf("expected the %s lock state in the metrics but got %s", statelocker.Queued, s)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://localhost/node-observability-status", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	var doc StatusDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unable to decode status: %v", err)
+	}
+	if doc.QueueDepth != 2 || doc.Queue[0].RunID != second || doc.Queue[0].Position != 1 || doc.Queue[1].RunID != third || doc.Queue[1].Position != 2 {
+		t.Fatalf("expected runs %s and %s to be queued but got %+v", second, third, doc.Queue)
+	}
+
+	// a queued run is removed from the queue
+	request(http.MethodPost, "/node-observability-runs/"+second.String()+"/cancel", http.StatusOK)
+	if q := h.queueStatus(); len(q) != 1 || q[0].RunID != third || q[0].Position != 1 {
+		t.Fatalf("expected run %s to be first in the queue but got %+v", third, q)
+	}
+
+	// the next queued run starts once the ongoing run is over
+	request(http.MethodPost, "/node-observability-runs/"+first.String()+"/cancel", http.StatusOK)
+	assertRunning(third)
+	if q := h.queueStatus(); len(q) != 0 {
+		t.Fatalf("expected the queue to be empty but got %+v", q)
+	}
+	if s, _ := h.metricsState(); s != statelocker.Taken {
+		t.Errorf("expected the %s lock state in the metrics but got %s", statelocker.Taken, s)
+	}
+
+	request(http.MethodPost, "/node-observability-runs/"+third.String()+"/cancel", http.StatusOK)
+	if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.Free {
+		t.Errorf("expected the agent to be free but was %s", s)
+	}
+}
+
+func TestRunQueueWaitsForErrorToClear(t *testing.T) {
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.Connector = &connectors.FakeConnector{Flag: connectors.Blocking}
+	h.QueueSize = 1
+
+	uid, _, err := h.stateLocker.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, state, err := h.acquire(func(uid uuid.UUID) {
+		h.startScripting(uid, scriptRun{command: "sh", params: []string{"-c", "true"}, timeout: scriptingTimeout})
+	})
+	if err != nil || state != statelocker.Queued {
+		t.Fatalf("expected run to be queued but state was %s: %v", state, err)
+	}
+
+	// the ongoing run fails: the queued run waits for the error to be cleared
+	arun := runs.Run{ID: uid, ExecutionRuns: []runs.ExecutionRun{{Type: runs.ScriptingRun, Error: "fake error"}}}
+	if err := h.stateLocker.SetError(arun); err != nil {
+		t.Fatal(err)
+	}
+	h.release()
+	if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.InError {
+		t.Fatalf("expected the agent to be in error but was %s", s)
+	}
+
+	if _, err := h.clearError(func(runs.Run) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if id, s, _ := h.stateLocker.LockInfo(); s != statelocker.Taken || id != queued {
+		t.Fatalf("expected queued run %s to be running but state was %s for run %s", queued, s, id)
+	}
+	if done, ok := h.cancelRun(queued); ok {
+		<-done
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/connectors"
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestScriptCatalog(t *testing.T) {
+	catalogDir := t.TempDir()
+	manifest := `{"Scripts":[
+		{"Name":"hello","File":"hello.sh","Description":"says hello","TimeoutSeconds":30},
+		{"Name":"hello-again","File":"hello.sh","Parameters":[{"Name":"NAME","Type":"enum","Default":"world","Values":["world","node"]}]}
+	]}`
+	if err := os.WriteFile(filepath.Join(catalogDir, scripts.CatalogFile), []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a bash script, run in its output directory from a catalog given by a relative path
+	if err := os.WriteFile(filepath.Join(catalogDir, "hello.sh"), []byte("#!/bin/bash\nwords=(hello)\necho \"${words[0]}\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relCatalogDir, err := filepath.Rel(wd, catalogDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := scripts.LoadCatalog(relCatalogDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewScriptingHandlers(t.TempDir(), "127.0.0.1")
+	h.ScriptCatalog = catalog
+
+	t.Run("list the catalog", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ListScripts(w, httptest.NewRequest(http.MethodGet, "http://localhost/node-observability-scripts", nil))
+		list := []scripts.Script{}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].Name != "hello" || list[0].Description != "says hello" || list[0].TimeoutSeconds != 30 {
+			t.Errorf("unexpected catalog %+v", list)
+		}
+	})
+
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "unknown script", body: `{"Script":"rm -rf /"}`, expectedCode: http.StatusBadRequest},
+		{name: "unknown field", body: `{"Command":"hello"}`, expectedCode: http.StatusBadRequest},
+		{name: "path of a script", body: `{"Script":"hello.sh"}`, expectedCode: http.StatusBadRequest},
+		{name: "invalid parameter value", body: `{"Script":"hello-again","Parameters":{"NAME":"$(reboot)"}}`, expectedCode: http.StatusBadRequest},
+		{name: "undeclared parameter", body: `{"Script":"hello","Parameters":{"NAME":"node"}}`, expectedCode: http.StatusBadRequest},
+		{name: "parameters of EXECUTE_SCRIPT", body: `{"Parameters":{"NAME":"node"}}`, expectedCode: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			connector := &recordingConnector{}
+			h.Connector = connector
+			w := httptest.NewRecorder()
+			h.HandleScripting(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-scripting", strings.NewReader(tc.body)))
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status code %d but was %d: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+			if _, s, _ := h.stateLocker.LockInfo(); s != statelocker.Free {
+				t.Errorf("expected the agent to stay free but was %s", s)
+			}
+			if connector.prepared {
+				t.Error("expected the script not to be prepared")
+			}
+		})
+	}
+
+	t.Run("run a script by name", func(t *testing.T) {
+		h.Connector = &connectors.Connector{}
+		w := httptest.NewRecorder()
+		h.HandleScripting(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-scripting", strings.NewReader(`{"Script":"hello"}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d but was %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var arun runs.Run
+		if err := json.Unmarshal(w.Body.Bytes(), &arun); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 50; i++ {
+			if _, s, _ := h.stateLocker.LockInfo(); s == statelocker.Free {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		arun, err := h.history.Get(arun.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !arun.Successful() || arun.ExecutionRuns[0].Target != "hello" {
+			t.Errorf("expected script hello to run successfully but got %+v", arun.ExecutionRuns)
+		}
+	})
+
+	t.Run("parameters are passed in the environment", func(t *testing.T) {
+		connector := &recordingConnector{}
+		h.Connector = connector
+		w := httptest.NewRecorder()
+		h.HandleScripting(w, httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-scripting", strings.NewReader(`{"Script":"hello-again","Parameters":{"NAME":"node"}}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d but was %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		for i := 0; i < 50; i++ {
+			if _, s, _ := h.stateLocker.LockInfo(); s == statelocker.Free {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if env := connector.opts.Env; len(env) == 0 || env[len(env)-1] != "NAME=node" {
+			t.Errorf("expected NAME=node in the environment but got %v", connector.opts.Env)
+		}
+	})
+}
+
+// recordingConnector records whether a command was prepared, and its options
+type recordingConnector struct {
+	connectors.FakeConnector
+	prepared bool
+	opts     connectors.CmdOptions
+}
+
+func (c *recordingConnector) Prepare(command string, params []string, opts connectors.CmdOptions) {
+	c.prepared = true
+	c.opts = opts
+	c.FakeConnector.Prepare(command, params, opts)
+}
@@ -1,22 +1,239 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/openshift/node-observability-agent/pkg/connectors"
 	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
+)
+
+const (
+	scriptOutputPrefix = "script"
+	stdoutFileExt      = "stdout"
+	stderrFileExt      = "stderr"
 )
 
-// executeScript executes the embedded script on the h.NodeIP
-func (h *Handlers) executeScript(uid string, cmd connectors.CmdWrapper) runs.ExecutionRun {
+// ScriptingRequest is the optional body of the scripting requests
+type ScriptingRequest struct {
+	// Script is the name of the script of the catalog to run,
+	// the EXECUTE_SCRIPT script is run if empty
+	Script string
+	// Parameters holds the values of the parameters declared by the script,
+	// they are passed to the script as environment variables
+	Parameters map[string]string
+}
+
+// scriptRun is the command of a scripting request
+type scriptRun struct {
+	// name is the name of the script in the catalog, empty for EXECUTE_SCRIPT
+	name string
+	// file is the path of the script file, verified against the allowlist
+	file string
+	// helpers are the paths of the files run by the script, verified along with it
+	helpers []string
+	command string
+	params  []string
+	// env holds the parameters of the script, NAME=value
+	env     []string
+	timeout int
+	limits  scripts.Limits
+}
+
+// collectorName returns the name of the script in the metrics
+func (sr scriptRun) collectorName() string {
+	if sr.name == "" {
+		return scriptCollectorName
+	}
+	return scriptCollectorName + "/" + sr.name
+}
+
+// ListScripts is called when the agent receives an HTTP request on endpoint /scripts.
+// It returns the scripts of the catalog which can be selected in the scripting requests.
+func (h *Handlers) ListScripts(w http.ResponseWriter, r *http.Request) {
+	list := []scripts.Script{}
+	if h.ScriptCatalog != nil {
+		list = h.ScriptCatalog.Scripts
+	}
+	if err := sendJSON(w, list); err != nil {
+		hlog.Error(err)
+	}
+}
+
+// parseScriptingRequest decodes the optional ScriptingRequest and resolves the script to run.
+// Scripts are selected by name from the catalog: names which aren't part of it are rejected,
+// and so are the scripts requiring capabilities the agent doesn't have, and the parameter
+// values which don't match the declarations of the script.
+func (h *Handlers) parseScriptingRequest(r *http.Request) (scriptRun, error) {
+	sreq := ScriptingRequest{}
+	if r.Body != nil {
+		decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&sreq); err != nil && !errors.Is(err, io.EOF) {
+			return scriptRun{}, fmt.Errorf("unable to decode scripting request: %w", err)
+		}
+	}
+
+	if sreq.Script == "" {
+		if len(sreq.Parameters) > 0 {
+			return scriptRun{}, fmt.Errorf("parameters can only be set for the scripts of the catalog")
+		}
+		script := os.Getenv("EXECUTE_SCRIPT")
+		if script == "" && h.ScriptCatalog != nil {
+			return scriptRun{}, fmt.Errorf("no script selected, and no EXECUTE_SCRIPT configured")
+		}
+		if h.ScriptAllowlist != nil {
+			// EXECUTE_SCRIPT is the path of a listed script, whose helpers are the scripts listed in its folder
+			return scriptRun{file: script, helpers: h.ScriptAllowlist.Helpers(script), command: "bash", params: []string{script}, timeout: scriptingTimeout}, nil
+		}
+		return scriptRun{file: script, command: "sh", params: []string{"-c", script}, timeout: scriptingTimeout}, nil
+	}
+
+	if h.ScriptCatalog == nil {
+		return scriptRun{}, fmt.Errorf("no script catalog configured, unable to run script %q", sreq.Script)
+	}
+	script, ok := h.ScriptCatalog.Get(sreq.Script)
+	if !ok {
+		return scriptRun{}, fmt.Errorf("unknown script %q", sreq.Script)
+	}
+	missing, err := script.MissingCapabilities()
+	if err != nil {
+		return scriptRun{}, fmt.Errorf("unable to check the capabilities required by script %q: %w", script.Name, err)
+	}
+	if len(missing) > 0 {
+		return scriptRun{}, fmt.Errorf("script %q requires the missing capabilities %s", script.Name, strings.Join(missing, ","))
+	}
+	env, err := script.Env(sreq.Parameters)
+	if err != nil {
+		return scriptRun{}, err
+	}
+	return scriptRun{
+		name:    script.Name,
+		file:    script.Path(),
+		helpers: script.HelperPaths(),
+		// the scripts of the catalog are bash scripts
+		command: "bash",
+		params:  []string{script.Path()},
+		env:     env,
+		timeout: script.Timeout(),
+		limits:  script.Limits,
+	}, nil
+}
+
+// executeScript executes the script of srun on the h.NodeIP, the script is killed if ctx is done
+// before its completion. Its stdout and stderr are saved to the script-<uid>.stdout and
+// script-<uid>.stderr files of the storage folder. The script runs in the fresh <uid> directory
+// of the storage folder, exported as OUTPUT_DIR along with RUN_ID and NODE_IP: all the files
+// written there are artifacts of the run. The limits of the script are applied once it starts,
+// and the limits it exceeded are recorded as LimitViolations. If an allowlist is configured,
+// the script file and its helpers are verified right before the execution, which runs their
+// verified copies in a private directory instead: EXECUTE_SCRIPT is then the path of a script file.
+func (h *Handlers) executeScript(ctx context.Context, uid string, srun scriptRun, cmd connectors.CmdWrapper) runs.ExecutionRun {
 	run := runs.ExecutionRun{
 		Type:      runs.ScriptingRun,
+		Target:    srun.name,
 		BeginTime: time.Now(),
 	}
 
-	message, err := cmd.CmdExec()
+	stdoutPath := h.outputFilePath(scriptOutputPrefix, uid, stdoutFileExt)
+	stderrPath := h.outputFilePath(scriptOutputPrefix, uid, stderrFileExt)
+	stdout, err := os.Create(stdoutPath)
+	if err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("unable to create the stdout file of the script: %v", err)
+		return run
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(stderrPath)
+	if err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("unable to create the stderr file of the script: %v", err)
+		return run
+	}
+	defer stderr.Close()
+
+	outputDir := filepath.Join(h.StorageFolder, uid)
+	if err := os.Mkdir(outputDir, 0700); err != nil {
+		run.EndTime = time.Now()
+		run.Error = fmt.Sprintf("unable to create the output directory of the script: %v", err)
+		return run
+	}
+	env := append([]string{"RUN_ID=" + uid, "OUTPUT_DIR=" + outputDir, "NODE_IP=" + h.NodeIP}, srun.env...)
+
+	var cgroup *scripts.Cgroup
+	if srun.limits.NeedsCgroup() {
+		cgroup, err = scripts.NewCgroup(h.ScriptCgroupParent, "run-"+uid, srun.limits)
+		if err != nil {
+			run.EndTime = time.Now()
+			run.Error = fmt.Sprintf("unable to create the cgroup of the script: %v", err)
+			return run
+		}
+		defer func() {
+			if err := cgroup.Remove(); err != nil {
+				hlog.Error(err)
+			}
+		}()
+	}
+	onStart := func(pid int) error {
+		if cgroup != nil {
+			if err := cgroup.Add(pid); err != nil {
+				return err
+			}
+		}
+		return srun.limits.Apply(pid)
+	}
+
+	command, params := srun.command, srun.params
+	if h.ScriptAllowlist != nil {
+		dir, err := os.MkdirTemp("", scriptOutputPrefix+"-"+uid+"-")
+		if err != nil {
+			run.EndTime = time.Now()
+			run.Error = fmt.Sprintf("unable to create the directory of the verified script: %v", err)
+			return run
+		}
+		defer os.RemoveAll(dir)
+		if err := h.ScriptAllowlist.Stage(dir, append([]string{srun.file}, srun.helpers...)...); err != nil {
+			run.EndTime = time.Now()
+			// only the scripts rejected by the allowlist fail the integrity check,
+			// not the ones which couldn't be read
+			if errors.Is(err, scripts.ErrNotAllowed) || errors.Is(err, scripts.ErrTampered) {
+				run.Error = fmt.Sprintf("integrity check of the script failed: %v", err)
+				run.FailureReason = runs.IntegrityFailure
+			} else {
+				run.Error = fmt.Sprintf("unable to verify the script: %v", err)
+			}
+			return run
+		}
+		command, params = "bash", []string{filepath.Join(dir, filepath.Base(srun.file))}
+	}
+
+	cmd.Prepare(command, params, connectors.CmdOptions{Env: env, Dir: outputDir, Stdout: stdout, Stderr: stderr, OnStart: onStart})
+	message, err := cmd.CmdExec(ctx)
 	run.EndTime = time.Now()
+	run.ExitCode, run.Signal = exitStatus(err)
+	run.LimitViolations = srun.limits.Violations(run.Signal, run.ExitCode)
+	if cgroup != nil {
+		violations, cgErr := cgroup.Violations()
+		if cgErr != nil {
+			hlog.Errorf("unable to read the limits exceeded by the script: %v", cgErr)
+		}
+		run.LimitViolations = append(run.LimitViolations, violations...)
+	}
+	run.StdoutBytes = fileSize(stdoutPath)
+	run.StderrBytes = fileSize(stderrPath)
 	if err != nil {
 		run.Error = fmt.Sprintf("error executing script :\n%s", message)
 	} else {
@@ -25,3 +242,32 @@ func (h *Handlers) executeScript(uid string, cmd connectors.CmdWrapper) runs.Exe
 	}
 	return run
 }
+
+// exitStatus returns the exit code of the script and the name of the signal
+// which killed it, given the error returned by its execution
+func exitStatus(err error) (int, string) {
+	if err == nil {
+		return 0, ""
+	}
+	// the process group of the script is killed when ctx is done
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return -1, unix.SignalName(syscall.SIGKILL)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ProcessState == nil {
+		return -1, ""
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return -1, unix.SignalName(status.Signal())
+	}
+	return exitErr.ExitCode(), ""
+}
+
+// fileSize returns the size of the file, 0 if it can't be read
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -1,20 +1,29 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/openshift/node-observability-agent/pkg/connectors"
 	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
 )
 
 // TestScriptingHandlers
 func TestScriptingHandlers(t *testing.T) {
 	// cover the pass scenario
 	t.Run("ScriptingHandlers : should pass", func(t *testing.T) {
-		h := NewScriptingHandlers("/tmp", "TEST")
-		connector := connectors.Connector{}
-		connector.Prepare("sh", []string{"-c", "ls -la"})
-		run := h.executeScript("12345678", &connector)
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		srun := scriptRun{command: "sh", params: []string{"-c", "ls -la"}}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
 		if !run.Successful || run.Type != runs.ScriptingRun {
 			t.Errorf("Expecting execution of script to pass, but got %q", run.Error)
 		}
@@ -22,12 +31,218 @@ func TestScriptingHandlers(t *testing.T) {
 
 	// cover the fail scenario
 	t.Run("ScriptingHandlers : should fail", func(t *testing.T) {
-		h := NewScriptingHandlers("/tmp", "TEST")
-		connector := connectors.Connector{}
-		connector.Prepare("sh", []string{"-c", "no-script-to-execute"})
-		run := h.executeScript("12345678", &connector)
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		srun := scriptRun{command: "sh", params: []string{"-c", "no-script-to-execute"}}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
 		if run.Successful || run.Type != runs.ScriptingRun {
 			t.Errorf("Expecting execution of script to fail, but got %v", run.Successful)
 		}
 	})
 }
+
+func TestScriptOutput(t *testing.T) {
+	testCases := []struct {
+		name             string
+		script           string
+		timeout          time.Duration
+		expectedExitCode int
+		expectedSignal   string
+		expectedStdout   string
+		expectedStderr   string
+	}{
+		{
+			name:           "outputs are saved",
+			script:         "echo hello; echo world >&2",
+			expectedStdout: "hello\n",
+			expectedStderr: "world\n",
+		},
+		{
+			name:             "exit code",
+			script:           "echo failed >&2; exit 3",
+			expectedExitCode: 3,
+			expectedStderr:   "failed\n",
+		},
+		{
+			name:             "script killed by a signal",
+			script:           "kill -TERM $$",
+			expectedExitCode: -1,
+			expectedSignal:   "SIGTERM",
+		},
+		{
+			name:             "script killed on cancellation",
+			script:           "echo started; sleep 60",
+			timeout:          500 * time.Millisecond,
+			expectedExitCode: -1,
+			expectedSignal:   "SIGKILL",
+			expectedStdout:   "started\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewScriptingHandlers(t.TempDir(), "TEST")
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			srun := scriptRun{command: "sh", params: []string{"-c", tc.script}}
+			run := h.executeScript(ctx, "12345678", srun, &connectors.Connector{})
+			if run.ExitCode != tc.expectedExitCode || run.Signal != tc.expectedSignal {
+				t.Errorf("expected exit code %d and signal %q but got %d and %q", tc.expectedExitCode, tc.expectedSignal, run.ExitCode, run.Signal)
+			}
+			for file, expected := range map[string]string{"script-12345678.stdout": tc.expectedStdout, "script-12345678.stderr": tc.expectedStderr} {
+				contents, err := os.ReadFile(h.StorageFolder + "/" + file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(contents) != expected {
+					t.Errorf("expected %q in %s but got %q", expected, file, contents)
+				}
+			}
+			if run.StdoutBytes != int64(len(tc.expectedStdout)) || run.StderrBytes != int64(len(tc.expectedStderr)) {
+				t.Errorf("unexpected output sizes %d and %d", run.StdoutBytes, run.StderrBytes)
+			}
+		})
+	}
+
+	t.Run("script runs in its output directory", func(t *testing.T) {
+		h := NewScriptingHandlers(t.TempDir(), "10.0.0.1")
+		srun := scriptRun{command: "sh", params: []string{"-c", `echo "$RUN_ID $NODE_IP" > result.txt && [ "$OUTPUT_DIR" = "$(pwd)" ]`}}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
+		if !run.Successful {
+			t.Fatalf("expected the script to run in OUTPUT_DIR: %s", run.Error)
+		}
+		contents, err := os.ReadFile(filepath.Join(h.StorageFolder, "12345678", "result.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != "12345678 10.0.0.1\n" {
+			t.Errorf("unexpected RUN_ID and NODE_IP %q", contents)
+		}
+	})
+
+	t.Run("tampered script", func(t *testing.T) {
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		script := filepath.Join(t.TempDir(), "hello.sh")
+		digests := filepath.Join(t.TempDir(), "digests.sha256")
+		if err := os.WriteFile(digests, []byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  "+script+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		allowlist, err := scripts.LoadAllowlist(digests, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ScriptAllowlist = allowlist
+
+		// the digest of the empty script
+		if err := os.WriteFile(script, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		srun := scriptRun{file: script, command: "sh", params: []string{script}}
+		if run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{}); !run.Successful {
+			t.Errorf("expected the script to run, but got %s", run.Error)
+		}
+
+		if err := os.WriteFile(script, []byte("echo hello\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		run := h.executeScript(context.Background(), "87654321", srun, &connectors.Connector{})
+		if run.Successful || run.FailureReason != runs.IntegrityFailure {
+			t.Errorf("expected the integrity check to fail, but got %+v", run)
+		}
+
+		// a script which can't be read isn't rejected by the allowlist
+		if err := os.Remove(script); err != nil {
+			t.Fatal(err)
+		}
+		run = h.executeScript(context.Background(), "23456789", srun, &connectors.Connector{})
+		if run.Successful || run.FailureReason != "" || !strings.Contains(run.Error, "unable to verify") {
+			t.Errorf("expected the script to fail without integrity failure, but got %+v", run)
+		}
+	})
+
+	t.Run("verified script and helper", func(t *testing.T) {
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		dir := t.TempDir()
+		script, helper := filepath.Join(dir, "network.sh"), filepath.Join(dir, "monitor.sh")
+		contents := map[string]string{script: `sh "$(dirname "$0")/monitor.sh"` + "\n", helper: "echo monitor\n"}
+		digests := ""
+		for path, content := range contents {
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256([]byte(content))
+			digests += hex.EncodeToString(sum[:]) + "  " + path + "\n"
+		}
+		digestsFile := filepath.Join(t.TempDir(), "digests.sha256")
+		if err := os.WriteFile(digestsFile, []byte(digests), 0600); err != nil {
+			t.Fatal(err)
+		}
+		allowlist, err := scripts.LoadAllowlist(digestsFile, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ScriptAllowlist = allowlist
+
+		// the command of the request is replaced by the verified copy of the script
+		srun := scriptRun{file: script, helpers: []string{helper}, command: "sh", params: []string{"-c", "echo unverified"}}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
+		stdout, err := os.ReadFile(h.outputFilePath(scriptOutputPrefix, "12345678", stdoutFileExt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !run.Successful || string(stdout) != "monitor\n" {
+			t.Errorf("expected the verified script to run its helper, but got %q: %s", stdout, run.Error)
+		}
+
+		// EXECUTE_SCRIPT runs the listed scripts of its folder
+		t.Setenv("EXECUTE_SCRIPT", script)
+		srun, err = h.parseScriptingRequest(httptest.NewRequest(http.MethodPost, "http://localhost/node-observability-scripting", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		run = h.executeScript(context.Background(), "23456789", srun, &connectors.Connector{})
+		stdout, err = os.ReadFile(h.outputFilePath(scriptOutputPrefix, "23456789", stdoutFileExt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !run.Successful || string(stdout) != "monitor\n" {
+			t.Errorf("expected EXECUTE_SCRIPT to run its helper, but got %q: %s", stdout, run.Error)
+		}
+
+		if err := os.WriteFile(helper, []byte("echo tampered\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		run = h.executeScript(context.Background(), "87654321", srun, &connectors.Connector{})
+		if run.Successful || run.FailureReason != runs.IntegrityFailure {
+			t.Errorf("expected the integrity check of the helper to fail, but got %+v", run)
+		}
+	})
+
+	t.Run("limit violations", func(t *testing.T) {
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		srun := scriptRun{
+			command: "sh",
+			params:  []string{"-c", "head -c 4096 /dev/zero > big"},
+			limits:  scripts.Limits{Nice: 5, FileSizeBytes: 1024},
+		}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
+		if run.Successful || len(run.LimitViolations) != 1 {
+			t.Errorf("expected the file size limit to be exceeded, but got %v", run.LimitViolations)
+		}
+	})
+
+	t.Run("in-memory output is truncated", func(t *testing.T) {
+		h := NewScriptingHandlers(t.TempDir(), "TEST")
+		// 200KiB of stderr
+		srun := scriptRun{command: "sh", params: []string{"-c", "head -c 204800 /dev/zero | tr '\\0' x >&2; exit 1"}}
+		run := h.executeScript(context.Background(), "12345678", srun, &connectors.Connector{})
+		if run.StderrBytes != 204800 {
+			t.Errorf("expected the whole stderr to be saved but got %d bytes", run.StderrBytes)
+		}
+		if len(run.Error) > connectors.MaxBufferedOutput+100 || !strings.Contains(run.Error, "bytes truncated") {
+			t.Errorf("expected the error message to be truncated, but got %d bytes", len(run.Error))
+		}
+	})
+}
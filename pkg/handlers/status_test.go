@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestStatusDocument(t *testing.T) {
+	testCases := []struct {
+		name          string
+		state         statelocker.State
+		accept        string
+		expectedCode  int
+		expectedCType string
+	}{
+		{
+			name:          "Service is ready, HTTP 200",
+			state:         statelocker.Free,
+			accept:        "application/json",
+			expectedCode:  http.StatusOK,
+			expectedCType: "application/json",
+		},
+		{
+			name:          "Service is busy, HTTP 409",
+			state:         statelocker.Taken,
+			accept:        "text/html, application/json;q=0.9",
+			expectedCode:  http.StatusConflict,
+			expectedCType: "application/json",
+		},
+		{
+			name:          "Service is in error, HTTP 500",
+			state:         statelocker.InError,
+			accept:        "application/json",
+			expectedCode:  http.StatusInternalServerError,
+			expectedCType: "application/json",
+		},
+		{
+			name:          "Text status without JSON accept header",
+			state:         statelocker.Free,
+			accept:        "text/plain",
+			expectedCode:  http.StatusOK,
+			expectedCType: "text/plain; charset=utf-8",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandlers("abc", makeCACertPool(), t.TempDir(), "/tmp/fakeSocket", "127.0.0.1", true, testTraceMaxBytes)
+			var id uuid.UUID
+			switch tc.state {
+			case statelocker.Taken:
+				id, _, _ = h.stateLocker.Lock()
+			case statelocker.InError:
+				id = uuid.MustParse(validUID)
+				arun := runs.Run{
+					ID: id,
+					ExecutionRuns: []runs.ExecutionRun{
+						{Type: runs.KubeletRun, BeginTime: time.Now().Add(-time.Minute), EndTime: time.Now(), Error: "fake error"},
+					},
+				}
+				if err := writeRunToFile(arun, h.runLogOutputFilePath(arun)); err != nil {
+					t.Fatal(err)
+				}
+				if err := h.stateLocker.SetError(arun); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest("GET", "http://localhost/node-observability-status", nil)
+			r.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+			h.Status(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedCode {
+				t.Errorf("expected status code %d but was %d", tc.expectedCode, resp.StatusCode)
+			}
+			if ctype := resp.Header.Get("Content-Type"); ctype != tc.expectedCType {
+				t.Fatalf("expected content type %q but was %q", tc.expectedCType, ctype)
+			}
+			if tc.expectedCType != "application/json" {
+				return
+			}
+
+			var doc StatusDocument
+			if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+				t.Fatalf("unable to decode status: %v", err)
+			}
+			if doc.State != tc.state {
+				t.Errorf("expected state %s but was %s", tc.state, doc.State)
+			}
+			if doc.Mode != "profiling" || !reflect.DeepEqual(doc.Collectors, []string{"kubelet", "crio"}) {
+				t.Errorf("unexpected mode %q or collectors %v", doc.Mode, doc.Collectors)
+			}
+			if tc.state == statelocker.Free {
+				if doc.RunID != nil || doc.StartTime != nil {
+					t.Errorf("expected no run in status but got %v started at %v", doc.RunID, doc.StartTime)
+				}
+				return
+			}
+			if doc.RunID == nil || *doc.RunID != id {
+				t.Errorf("expected run %s but got %v", id, doc.RunID)
+			}
+			if doc.StartTime == nil {
+				t.Error("expected the start time of the run")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package history
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrArtifactNotFound is returned when a run has no artifact of the requested name
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// Artifact is a file produced by a run
+type Artifact struct {
+	// Name is the path of the file relative to the storage folder
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Artifacts returns the files produced by the run of the given ID: the files of the storage
+// folder named after the run ID, and the files of the storage folder's <run ID> directory.
+func (s *Store) Artifacts(id uuid.UUID) ([]Artifact, error) {
+	entries, err := os.ReadDir(s.folder)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the storage folder: %w", err)
+	}
+
+	artifacts := []Artifact{}
+	for _, e := range entries {
+		if e.IsDir() || !e.Type().IsRegular() || !strings.Contains(e.Name(), id.String()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read artifact %s: %w", e.Name(), err)
+		}
+		artifacts = append(artifacts, Artifact{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+
+	runDir := filepath.Join(s.folder, id.String())
+	err = filepath.WalkDir(runDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// symlinks are skipped so that no file outside of the run directory can be served
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(s.folder, path)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, Artifact{Name: filepath.ToSlash(name), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read the directory of run %s: %w", id, err)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+// OpenArtifact opens the artifact of the given name produced by the run of the given ID.
+// Only the names returned by Artifacts can be opened, other names return ErrArtifactNotFound.
+func (s *Store) OpenArtifact(id uuid.UUID, name string) (*os.File, error) {
+	artifacts, err := s.Artifacts(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range artifacts {
+		if a.Name == name {
+			/* #nosec G304 the name is one of the artifacts listed from the storage folder */
+			return os.Open(filepath.Join(s.folder, filepath.FromSlash(a.Name)))
+		}
+	}
+	return nil, ErrArtifactNotFound
+}
+
+// WriteArchive writes a tar.gz archive of all the artifacts of the run of the given ID into w.
+func (s *Store) WriteArchive(id uuid.UUID, w io.Writer) error {
+	artifacts, err := s.Artifacts(id)
+	if err != nil {
+		return err
+	}
+	return s.writeArchive(artifacts, w)
+}
+
+// Archive builds the tar.gz archive of all the artifacts of the run of the given ID into a temporary file
+// of the storage folder, and returns it opened at its start along with the last modification time of the
+// artifacts. The file is removed once built: it's freed when closed.
+func (s *Store) Archive(id uuid.UUID) (*os.File, time.Time, error) {
+	artifacts, err := s.Artifacts(id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var modTime time.Time
+	for _, a := range artifacts {
+		if a.ModTime.After(modTime) {
+			modTime = a.ModTime
+		}
+	}
+
+	// the name of the temporary file doesn't contain the run ID, it's never listed as an artifact
+	f, err := os.CreateTemp(s.folder, ".archive-*.tar.gz")
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to create archive: %w", err)
+	}
+	_ = os.Remove(f.Name())
+	if err := s.writeArchive(artifacts, f); err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, time.Time{}, fmt.Errorf("unable to read archive: %w", err)
+	}
+	return f, modTime, nil
+}
+
+func (s *Store) writeArchive(artifacts []Artifact, w io.Writer) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	for _, a := range artifacts {
+		if err := s.addToArchive(tw, a); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("unable to write archive: %w", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return fmt.Errorf("unable to compress archive: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) addToArchive(tw *tar.Writer, a Artifact) error {
+	/* #nosec G304 the name is one of the artifacts listed from the storage folder */
+	f, err := os.Open(filepath.Join(s.folder, filepath.FromSlash(a.Name)))
+	if err != nil {
+		return fmt.Errorf("unable to open artifact %s: %w", a.Name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to read artifact %s: %w", a.Name, err)
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("unable to create archive header of %s: %w", a.Name, err)
+	}
+	header.Name = a.Name
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("unable to write archive header of %s: %w", a.Name, err)
+	}
+	// the file may still be growing: only copy the size announced in the header
+	if _, err := io.CopyN(tw, f, header.Size); err != nil {
+		return fmt.Errorf("unable to archive %s: %w", a.Name, err)
+	}
+	return nil
+}
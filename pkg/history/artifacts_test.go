@@ -0,0 +1,163 @@
+package history
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const artifactsRunID = "dd37122b-daaf-4d75-9250-c0747e9c5c47"
+
+func prepareArtifacts(t *testing.T) (*Store, string) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"kubelet-" + artifactsRunID + ".pprof":   "kubelet",
+		"crio-heap-" + artifactsRunID + ".pprof": "crio",
+		artifactsRunID + ".log":                  "{}",
+		artifactsRunID + "/results/metrics.txt":  "metrics",
+		"kubelet-" + uuid.NewString() + ".pprof": "other run",
+		"agent.err":                              "{}",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// links must not allow serving files outside of the run
+	if err := os.Symlink(filepath.Join(dir, "agent.err"), filepath.Join(dir, artifactsRunID, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dir), dir
+}
+
+func TestArtifacts(t *testing.T) {
+	s, _ := prepareArtifacts(t)
+	artifacts, err := s.Artifacts(uuid.MustParse(artifactsRunID))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, a := range artifacts {
+		names = append(names, a.Name)
+	}
+	expected := []string{
+		"crio-heap-" + artifactsRunID + ".pprof",
+		artifactsRunID + ".log",
+		artifactsRunID + "/results/metrics.txt",
+		"kubelet-" + artifactsRunID + ".pprof",
+	}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected artifacts %v but got %v", expected, names)
+	}
+
+	artifacts, err = s.Artifacts(uuid.New())
+	if err != nil || len(artifacts) != 0 {
+		t.Errorf("expected no artifact for an unknown run but got %v: %v", artifacts, err)
+	}
+}
+
+func TestOpenArtifact(t *testing.T) {
+	s, _ := prepareArtifacts(t)
+	id := uuid.MustParse(artifactsRunID)
+	f, err := s.OpenArtifact(id, artifactsRunID+"/results/metrics.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	if contents, err := io.ReadAll(f); err != nil || string(contents) != "metrics" {
+		t.Errorf("expected metrics contents but got %q: %v", contents, err)
+	}
+
+	for _, name := range []string{"agent.err", "../agent.err", artifactsRunID + "/link", artifactsRunID + "/../agent.err"} {
+		if _, err := s.OpenArtifact(id, name); !errors.Is(err, ErrArtifactNotFound) {
+			t.Errorf("expected ErrArtifactNotFound opening %s but got %v", name, err)
+		}
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	s, _ := prepareArtifacts(t)
+	var buf bytes.Buffer
+	if err := s.WriteArchive(uuid.MustParse(artifactsRunID), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gzr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	contents := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[header.Name] = string(b)
+	}
+	if len(contents) != 4 {
+		t.Errorf("expected 4 files in the archive but got %v", contents)
+	}
+	if contents["kubelet-"+artifactsRunID+".pprof"] != "kubelet" {
+		t.Errorf("unexpected kubelet profile in the archive: %q", contents["kubelet-"+artifactsRunID+".pprof"])
+	}
+}
+
+func TestArchive(t *testing.T) {
+	s, dir := prepareArtifacts(t)
+	id := uuid.MustParse(artifactsRunID)
+	var buf bytes.Buffer
+	if err := s.WriteArchive(id, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, modTime, err := s.Archive(id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the archive of the same artifacts is identical, a download can be resumed
+	if !bytes.Equal(contents, buf.Bytes()) {
+		t.Error("expected the archive to be identical to the written one")
+	}
+	if modTime.IsZero() {
+		t.Error("expected the modification time of the artifacts")
+	}
+	artifacts, err := s.Artifacts(id)
+	if err != nil || len(artifacts) != 4 {
+		t.Errorf("expected the temporary archive not to be listed but got %v: %v", artifacts, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".archive-") {
+			t.Errorf("expected the temporary archive to be removed but found %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+// runFileExt is the extension of the files holding the runs, named <run ID>.log
+const runFileExt = ".log"
+
+var hslog = logrus.WithField("module", "history")
+
+// ErrRunNotFound is returned when no run with the requested ID exists in the history
+var ErrRunNotFound = errors.New("run not found")
+
+// Filter selects runs from the history, zero values match all the runs
+type Filter struct {
+	// Type selects the runs having at least one execution run of this type
+	Type runs.RunType
+	// Successful selects the successful runs if true, the failed ones if false
+	Successful *bool
+	// Since selects the runs which began at or after this time
+	Since time.Time
+	// Until selects the runs which began before this time
+	Until time.Time
+}
+
+// Match returns true if the run is selected by the filter
+func (f Filter) Match(r runs.Run) bool {
+	if f.Type != "" && !r.HasType(f.Type) {
+		return false
+	}
+	if f.Successful != nil && *f.Successful != r.Successful() {
+		return false
+	}
+	if !f.Since.IsZero() && r.BeginTime().Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.BeginTime().Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// RunList is a page of runs from the history
+type RunList struct {
+	// Total is the number of runs matching the filter
+	Total int
+	// Offset is the position of the first run of the page
+	Offset int
+	Runs   []runs.Run
+}
+
+// Store reads the runs saved in the storage folder of the agent
+type Store struct {
+	folder string
+}
+
+// NewStore creates a store reading the runs saved into folder
+func NewStore(folder string) *Store {
+	return &Store{folder: folder}
+}
+
+// Get returns the run of the given ID, or ErrRunNotFound
+func (s *Store) Get(id uuid.UUID) (runs.Run, error) {
+	run, err := readRun(filepath.Join(s.folder, id.String()+runFileExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return run, ErrRunNotFound
+	}
+	return run, err
+}
+
+// List returns at most limit runs matching the filter, newest first, skipping the first offset ones
+func (s *Store) List(filter Filter, offset, limit int) (RunList, error) {
+	entries, err := os.ReadDir(s.folder)
+	if err != nil {
+		return RunList{}, fmt.Errorf("unable to read the run history: %w", err)
+	}
+
+	matching := []runs.Run{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, runFileExt) {
+			continue
+		}
+		if _, err := uuid.Parse(strings.TrimSuffix(name, runFileExt)); err != nil {
+			continue
+		}
+		run, err := readRun(filepath.Join(s.folder, name))
+		if err != nil {
+			// a corrupted run shouldn't hide the rest of the history
+			hslog.Errorf("skipping run file %s: %v", name, err)
+			continue
+		}
+		if filter.Match(run) {
+			matching = append(matching, run)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].BeginTime().After(matching[j].BeginTime())
+	})
+
+	list := RunList{
+		Total:  len(matching),
+		Offset: offset,
+		Runs:   []runs.Run{},
+	}
+	if offset < len(matching) {
+		end := offset + limit
+		if end > len(matching) {
+			end = len(matching)
+		}
+		list.Runs = matching[offset:end]
+	}
+	return list, nil
+}
+
+func readRun(filePath string) (runs.Run, error) {
+	run := runs.Run{}
+	/* #nosec G304 the file path is built from the storage folder and a run ID */
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal(contents, &run); err != nil {
+		return run, fmt.Errorf("unable to unmarshal run from %s: %w", filePath, err)
+	}
+	return run, nil
+}
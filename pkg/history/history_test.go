@@ -0,0 +1,158 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+)
+
+var (
+	baseTime = time.Date(2022, 3, 3, 10, 0, 0, 0, time.UTC)
+	oldRun   = newTestRun("dd37122b-daaf-4d75-9250-c0747e9c5c47", runs.KubeletRun, baseTime, true)
+	midRun   = newTestRun("5b3ab1c2-7a0e-4c5e-9d3f-0e1a2b3c4d5e", runs.ScriptingRun, baseTime.Add(time.Hour), false)
+	newRun   = newTestRun("0f8fad5b-d9cb-469f-a165-70867728950e", runs.CrioRun, baseTime.Add(2*time.Hour), true)
+)
+
+func newTestRun(id string, rtype runs.RunType, begin time.Time, successful bool) runs.Run {
+	er := runs.ExecutionRun{
+		Type:       rtype,
+		Successful: successful,
+		BeginTime:  begin,
+		EndTime:    begin.Add(30 * time.Second),
+	}
+	if !successful {
+		er.Error = "fake error"
+	}
+	return runs.Run{
+		ID:            uuid.MustParse(id),
+		ExecutionRuns: []runs.ExecutionRun{er},
+	}
+}
+
+func prepareStore(t *testing.T) *Store {
+	dir := t.TempDir()
+	for _, r := range []runs.Run{oldRun, midRun, newRun} {
+		contents, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, r.ID.String()+runFileExt), contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files which are not runs are ignored
+	if err := os.WriteFile(filepath.Join(dir, "agent.err"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.log"), []byte("not a run"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, uuid.NewString()+runFileExt), []byte("corrupted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dir)
+}
+
+func TestList(t *testing.T) {
+	successful := true
+	failed := false
+	testCases := []struct {
+		name          string
+		filter        Filter
+		offset        int
+		limit         int
+		expectedTotal int
+		expectedIDs   []uuid.UUID
+	}{
+		{
+			name:          "All runs, newest first",
+			limit:         10,
+			expectedTotal: 3,
+			expectedIDs:   []uuid.UUID{newRun.ID, midRun.ID, oldRun.ID},
+		},
+		{
+			name:          "Second page",
+			offset:        1,
+			limit:         1,
+			expectedTotal: 3,
+			expectedIDs:   []uuid.UUID{midRun.ID},
+		},
+		{
+			name:          "Offset after the last run",
+			offset:        5,
+			limit:         10,
+			expectedTotal: 3,
+			expectedIDs:   []uuid.UUID{},
+		},
+		{
+			name:          "Filter by type",
+			filter:        Filter{Type: runs.ScriptingRun},
+			limit:         10,
+			expectedTotal: 1,
+			expectedIDs:   []uuid.UUID{midRun.ID},
+		},
+		{
+			name:          "Successful runs",
+			filter:        Filter{Successful: &successful},
+			limit:         10,
+			expectedTotal: 2,
+			expectedIDs:   []uuid.UUID{newRun.ID, oldRun.ID},
+		},
+		{
+			name:          "Failed runs",
+			filter:        Filter{Successful: &failed},
+			limit:         10,
+			expectedTotal: 1,
+			expectedIDs:   []uuid.UUID{midRun.ID},
+		},
+		{
+			name:          "Time window",
+			filter:        Filter{Since: baseTime.Add(time.Minute), Until: baseTime.Add(2 * time.Hour)},
+			limit:         10,
+			expectedTotal: 1,
+			expectedIDs:   []uuid.UUID{midRun.ID},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := prepareStore(t)
+			list, err := s.List(tc.filter, tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectedTotal != list.Total {
+				t.Errorf("expected %d runs in total but got %d", tc.expectedTotal, list.Total)
+			}
+			if len(tc.expectedIDs) != len(list.Runs) {
+				t.Fatalf("expected %d runs but got %d", len(tc.expectedIDs), len(list.Runs))
+			}
+			for i, id := range tc.expectedIDs {
+				if list.Runs[i].ID != id {
+					t.Errorf("expected run %d to be %s but was %s", i, id, list.Runs[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	s := prepareStore(t)
+	run, err := s.Get(midRun.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.ID != midRun.ID || run.Successful() {
+		t.Errorf("expected failed run %s but got %v", midRun.ID, run)
+	}
+
+	if _, err := s.Get(uuid.New()); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("expected ErrRunNotFound but got %v", err)
+	}
+}
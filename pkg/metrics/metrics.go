@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+const namespace = "node_observability_agent"
+
+// StateFunc returns the current state of the agent,
+// and when in error, the time at which the error occurred
+type StateFunc func() (statelocker.State, time.Time)
+
+// Metrics holds the prometheus metrics of the agent
+type Metrics struct {
+	registry          *prometheus.Registry
+	runsStarted       *prometheus.CounterVec
+	runsCompleted     *prometheus.CounterVec
+	runsFailed        *prometheus.CounterVec
+	runsCancelled     *prometheus.CounterVec
+	collectorDuration *prometheus.HistogramVec
+	bytesWritten      prometheus.Counter
+	state             *stateCollector
+}
+
+// New creates the metrics of the agent, the lock state
+// and the time spent in error are read from state on each scrape.
+func New(state StateFunc) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		runsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_started_total",
+			Help:      "Number of execution runs started, per run type.",
+		}, []string{"type"}),
+		runsCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_completed_total",
+			Help:      "Number of execution runs completed successfully, per run type.",
+		}, []string{"type"}),
+		runsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_failed_total",
+			Help:      "Number of execution runs in error, including the ones in timeout, per run type.",
+		}, []string{"type"}),
+		runsCancelled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_cancelled_total",
+			Help:      "Number of execution runs stopped by the cancellation of their run, per run type.",
+		}, []string{"type"}),
+		collectorDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "collector_duration_seconds",
+			Help:      "Duration of the execution runs, per collector.",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+		}, []string{"collector"}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_written_bytes_total",
+			Help:      "Number of bytes of artifacts written to the storage folder.",
+		}),
+		state: newStateCollector(state),
+	}
+	m.registry.MustRegister(
+		m.runsStarted,
+		m.runsCompleted,
+		m.runsFailed,
+		m.runsCancelled,
+		m.collectorDuration,
+		m.bytesWritten,
+		m.state,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler returns the HTTP handler exposing the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RunStarted counts the start of an execution run of the given type
+func (m *Metrics) RunStarted(t runs.RunType) {
+	m.runsStarted.WithLabelValues(string(t)).Inc()
+}
+
+// RunFinished counts the execution run as completed, failed or cancelled
+func (m *Metrics) RunFinished(er runs.ExecutionRun) {
+	if er.Cancelled {
+		m.runsCancelled.WithLabelValues(string(er.Type)).Inc()
+		return
+	}
+	if er.Error != "" {
+		m.runsFailed.WithLabelValues(string(er.Type)).Inc()
+		return
+	}
+	m.runsCompleted.WithLabelValues(string(er.Type)).Inc()
+}
+
+// ObserveCollector records the duration of the execution run of the named collector
+func (m *Metrics) ObserveCollector(name string, er runs.ExecutionRun) {
+	m.collectorDuration.WithLabelValues(name).Observe(er.EndTime.Sub(er.BeginTime).Seconds())
+}
+
+// AddBytesWritten counts bytes written to the storage folder
+func (m *Metrics) AddBytesWritten(n int64) {
+	m.bytesWritten.Add(float64(n))
+}
+
+// ErrorCleared adds the duration of an error, which has been cleared,
+// to the time spent in error
+func (m *Metrics) ErrorCleared(d time.Duration) {
+	m.state.errorCleared(d)
+}
+
+// stateCollector exposes the lock state and the time spent in error,
+// both computed from the state of the agent on scrape
+type stateCollector struct {
+	state        StateFunc
+	lockState    *prometheus.Desc
+	errorSeconds *prometheus.Desc
+
+	mux                 sync.Mutex
+	clearedErrorSeconds float64
+}
+
+func newStateCollector(state StateFunc) *stateCollector {
+	return &stateCollector{
+		state: state,
+		lockState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "lock_state"),
+			"State of the agent lock, 1 for the current state.",
+			[]string{"state"}, nil),
+		errorSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "error_state_seconds_total"),
+			"Time spent by the agent in the error state.",
+			nil, nil),
+	}
+}
+
+func (c *stateCollector) errorCleared(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.clearedErrorSeconds += d.Seconds()
+}
+
+// Describe implements prometheus.Collector
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lockState
+	ch <- c.errorSeconds
+}
+
+// Collect implements prometheus.Collector
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	state, errorSince := c.state()
+	for _, s := range []statelocker.State{statelocker.Free, statelocker.Taken, statelocker.Queued, statelocker.InError} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.lockState, prometheus.GaugeValue, value, string(s))
+	}
+
+	c.mux.Lock()
+	errorSeconds := c.clearedErrorSeconds
+	c.mux.Unlock()
+	if state == statelocker.InError && !errorSince.IsZero() {
+		errorSeconds += time.Since(errorSince).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(c.errorSeconds, prometheus.CounterValue, errorSeconds)
+}
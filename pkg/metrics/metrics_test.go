@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/node-observability-agent/pkg/runs"
+	"github.com/openshift/node-observability-agent/pkg/statelocker"
+)
+
+func TestMetrics(t *testing.T) {
+	state := statelocker.InError
+	errorSince := time.Now().Add(-time.Minute)
+	m := New(func() (statelocker.State, time.Time) {
+		return state, errorSince
+	})
+
+	begin := time.Now()
+	m.RunStarted(runs.KubeletRun)
+	m.RunStarted(runs.CrioRun)
+	m.RunFinished(runs.ExecutionRun{Type: runs.KubeletRun})
+	m.RunFinished(runs.ExecutionRun{Type: runs.CrioRun, Error: "fake error"})
+	m.ObserveCollector("kubelet/profile", runs.ExecutionRun{BeginTime: begin, EndTime: begin.Add(30 * time.Second)})
+	m.AddBytesWritten(1024)
+	m.ErrorCleared(time.Hour)
+
+	metrics := scrape(t, m)
+	for _, expected := range []string{
+		`node_observability_agent_runs_started_total{type="Kubelet"} 1`,
+		`node_observability_agent_runs_started_total{type="CRIO"} 1`,
+		`node_observability_agent_runs_completed_total{type="Kubelet"} 1`,
+		`node_observability_agent_runs_failed_total{type="CRIO"} 1`,
+		`node_observability_agent_collector_duration_seconds_sum{collector="kubelet/profile"} 30`,
+		`node_observability_agent_storage_written_bytes_total 1024`,
+		`node_observability_agent_lock_state{state="ERROR"} 1`,
+		`node_observability_agent_lock_state{state="FREE"} 0`,
+		`node_observability_agent_lock_state{state="QUEUED"} 0`,
+	} {
+		if !strings.Contains(metrics, expected+"\n") {
+			t.Errorf("expected metric %q in:\n%s", expected, metrics)
+		}
+	}
+	if errorSeconds := errorStateSeconds(t, metrics); errorSeconds < 3660 {
+		t.Errorf("expected the cleared and current error durations, at least 3660s, but was %v", errorSeconds)
+	}
+
+	// once free, only the errors cleared are accounted
+	state = statelocker.Free
+	if errorSeconds := errorStateSeconds(t, scrape(t, m)); errorSeconds != 3600 {
+		t.Errorf("expected the cleared error duration, 3600s, but was %v", errorSeconds)
+	}
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/metrics", nil))
+	body, err := io.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func errorStateSeconds(t *testing.T, metrics string) float64 {
+	const name = "node_observability_agent_error_state_seconds_total "
+	for _, line := range strings.Split(metrics, "\n") {
+		if strings.HasPrefix(line, name) {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, name), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
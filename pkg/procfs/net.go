@@ -0,0 +1,216 @@
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// hostNetPID is the process whose network namespace is read: PID 1 of the procfs of the host is the init
+// of the node, in the network namespace of the node, while /proc/net is the one of the agent running in a pod
+const hostNetPID = "1"
+
+// NetDevStats holds the statistics of a network interface of /proc/1/net/dev
+type NetDevStats struct {
+	RxBytes      uint64
+	RxPackets    uint64
+	RxErrs       uint64
+	RxDrop       uint64
+	RxFifo       uint64
+	RxFrame      uint64
+	RxCompressed uint64
+	RxMulticast  uint64
+	TxBytes      uint64
+	TxPackets    uint64
+	TxErrs       uint64
+	TxDrop       uint64
+	TxFifo       uint64
+	TxColls      uint64
+	TxCarrier    uint64
+	TxCompressed uint64
+}
+
+// SoftnetStat holds the packet processing statistics of a CPU of /proc/1/net/softnet_stat
+type SoftnetStat struct {
+	CPU            int
+	Processed      uint64
+	Dropped        uint64
+	TimeSqueeze    uint64
+	CPUCollision   uint64
+	ReceivedRPS    uint64
+	FlowLimitCount uint64
+}
+
+// Conntrack holds the number of tracked connections and the size of the conntrack table
+type Conntrack struct {
+	Count uint64
+	Max   uint64
+}
+
+// SNMP reads /proc/1/net/snmp, the counters of each protocol by name
+func (fs FS) SNMP() (map[string]map[string]int64, error) {
+	return fs.readProtocolCounters(hostNetPID, "net", "snmp")
+}
+
+// Netstat reads /proc/1/net/netstat, the extended counters of TcpExt, IpExt and MPTcpExt by name
+func (fs FS) Netstat() (map[string]map[string]int64, error) {
+	return fs.readProtocolCounters(hostNetPID, "net", "netstat")
+}
+
+// readProtocolCounters parses the files made of pairs of lines, "Proto: name..." then "Proto: value..."
+func (fs FS) readProtocolCounters(elem ...string) (map[string]map[string]int64, error) {
+	content, err := fs.readFile(elem...)
+	if err != nil {
+		return nil, err
+	}
+	counters := map[string]map[string]int64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		names := strings.Fields(scanner.Text())
+		if len(names) == 0 {
+			continue
+		}
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("missing values of %s in %s", names[0], strings.Join(elem, "/"))
+		}
+		values := strings.Fields(scanner.Text())
+		if len(names) != len(values) || names[0] != values[0] {
+			return nil, fmt.Errorf("invalid %s", strings.Join(elem, "/"))
+		}
+		proto := strings.TrimSuffix(names[0], ":")
+		counters[proto] = map[string]int64{}
+		for i := 1; i < len(names); i++ {
+			// some values, such as Tcp MaxConn, are negative
+			v, _ := strconv.ParseInt(values[i], 10, 64)
+			counters[proto][names[i]] = v
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// NetDev reads /proc/1/net/dev, the statistics of each network interface
+func (fs FS) NetDev() (map[string]NetDevStats, error) {
+	content, err := fs.readFile(hostNetPID, "net", "dev")
+	if err != nil {
+		return nil, err
+	}
+	devices := map[string]NetDevStats{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// the name can be stuck to the first value, and the header has no ":"
+		name, stats, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(stats)
+		if len(fields) < 16 {
+			continue
+		}
+		v := parseUints(fields[:16])
+		devices[strings.TrimSpace(name)] = NetDevStats{
+			RxBytes: v[0], RxPackets: v[1], RxErrs: v[2], RxDrop: v[3],
+			RxFifo: v[4], RxFrame: v[5], RxCompressed: v[6], RxMulticast: v[7],
+			TxBytes: v[8], TxPackets: v[9], TxErrs: v[10], TxDrop: v[11],
+			TxFifo: v[12], TxColls: v[13], TxCarrier: v[14], TxCompressed: v[15],
+		}
+	}
+	return devices, scanner.Err()
+}
+
+// Sockstat reads /proc/1/net/sockstat, the number of sockets of each protocol by state,
+// the mem values are in pages
+func (fs FS) Sockstat() (map[string]map[string]int64, error) {
+	content, err := fs.readFile(hostNetPID, "net", "sockstat")
+	if err != nil {
+		return nil, err
+	}
+	sockstat := map[string]map[string]int64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		proto, stats, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		// the values follow their names: "inuse 5 orphan 0 tw 2"
+		fields := strings.Fields(stats)
+		values := map[string]int64{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			v, _ := strconv.ParseInt(fields[i+1], 10, 64)
+			values[fields[i]] = v
+		}
+		sockstat[proto] = values
+	}
+	return sockstat, scanner.Err()
+}
+
+// SoftnetStat reads /proc/1/net/softnet_stat, one line of hexadecimal values per online CPU
+func (fs FS) SoftnetStat() ([]SoftnetStat, error) {
+	content, err := fs.readFile(hostNetPID, "net", "softnet_stat")
+	if err != nil {
+		return nil, err
+	}
+	stats := []SoftnetStat{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 11 {
+			return nil, fmt.Errorf("invalid line %d of %s/net/softnet_stat", line+1, hostNetPID)
+		}
+		v := make([]uint64, len(fields))
+		for i, f := range fields {
+			v[i], _ = strconv.ParseUint(f, 16, 64)
+		}
+		s := SoftnetStat{
+			CPU: line, Processed: v[0], Dropped: v[1], TimeSqueeze: v[2],
+			CPUCollision: v[8], ReceivedRPS: v[9], FlowLimitCount: v[10],
+		}
+		// the kernel has no line for the offline CPUs, so the line number is only the CPU
+		// when they are all online: the recent kernels give the CPU of the line
+		if len(v) >= 13 {
+			s.CPU = int(v[12])
+		}
+		stats = append(stats, s)
+	}
+	return stats, scanner.Err()
+}
+
+// Conntrack reads the entries of /proc/1/net/stat/nf_conntrack, and /proc/sys/net/netfilter/nf_conntrack_max,
+// which only exist when the nf_conntrack module is loaded. /proc/sys/net is the one of the network namespace of
+// the agent, but nf_conntrack_max is the size of the table shared by all the namespaces.
+func (fs FS) Conntrack() (Conntrack, error) {
+	content, err := fs.readFile(hostNetPID, "net", "stat", "nf_conntrack")
+	if err != nil {
+		return Conntrack{}, err
+	}
+	// a header line, followed by one line of hexadecimal values per CPU, each
+	// starting with the number of connections of the namespace
+	lines := strings.Split(string(content), "\n")
+	header := strings.Fields(lines[0])
+	if len(lines) < 2 || len(header) == 0 || header[0] != "entries" {
+		return Conntrack{}, fmt.Errorf("invalid %s/net/stat/nf_conntrack", hostNetPID)
+	}
+	values := strings.Fields(lines[1])
+	if len(values) == 0 {
+		return Conntrack{}, fmt.Errorf("no entries in %s/net/stat/nf_conntrack", hostNetPID)
+	}
+	count, err := strconv.ParseUint(values[0], 16, 64)
+	if err != nil {
+		return Conntrack{}, fmt.Errorf("invalid entries in %s/net/stat/nf_conntrack: %w", hostNetPID, err)
+	}
+	size, err := fs.readUint("sys", "net", "netfilter", "nf_conntrack_max")
+	if err != nil {
+		return Conntrack{}, err
+	}
+	return Conntrack{Count: count, Max: size}, nil
+}
+
+// readUint reads a file holding a single unsigned integer
+func (fs FS) readUint(elem ...string) (uint64, error) {
+	content, err := fs.readFile(elem...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
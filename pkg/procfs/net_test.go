@@ -0,0 +1,142 @@
+package procfs
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestProtocolCounters(t *testing.T) {
+	proc := writeFixture(t, map[string]string{
+		"1/net/snmp": `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 1000
+Tcp: RtoMin MaxConn ActiveOpens CurrEstab
+Tcp: 200 -1 42 7
+`,
+		"1/net/netstat": `TcpExt: SyncookiesSent ListenOverflows
+TcpExt: 0 3
+`,
+		// the network namespace of the agent
+		"net/snmp": `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 1
+`,
+		"invalid/snmp": `Ip: Forwarding DefaultTTL
+Ip: 1
+`,
+	})
+	snmp, err := proc.SNMP()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]map[string]int64{
+		"Ip":  {"Forwarding": 1, "DefaultTTL": 64, "InReceives": 1000},
+		"Tcp": {"RtoMin": 200, "MaxConn": -1, "ActiveOpens": 42, "CurrEstab": 7},
+	}
+	if !reflect.DeepEqual(expected, snmp) {
+		t.Errorf("expected snmp %v but got %v", expected, snmp)
+	}
+
+	netstat, err := proc.Netstat()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]map[string]int64{"TcpExt": {"SyncookiesSent": 0, "ListenOverflows": 3}}; !reflect.DeepEqual(expected, netstat) {
+		t.Errorf("expected netstat %v but got %v", expected, netstat)
+	}
+
+	if _, err := proc.readProtocolCounters("invalid", "snmp"); err == nil {
+		t.Error("expected error parsing names without their values but got none")
+	}
+}
+
+func TestNetDev(t *testing.T) {
+	proc := writeFixture(t, map[string]string{"1/net/dev": `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0:123456789 2000 1 2 3 4 5 6 987654 3000 7 8 9 10 11 12
+`})
+	devices, err := proc.NetDev()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]NetDevStats{
+		"lo": {RxBytes: 1000, RxPackets: 10, TxBytes: 1000, TxPackets: 10},
+		"eth0": {
+			RxBytes: 123456789, RxPackets: 2000, RxErrs: 1, RxDrop: 2, RxFifo: 3, RxFrame: 4, RxCompressed: 5, RxMulticast: 6,
+			TxBytes: 987654, TxPackets: 3000, TxErrs: 7, TxDrop: 8, TxFifo: 9, TxColls: 10, TxCarrier: 11, TxCompressed: 12,
+		},
+	}
+	if !reflect.DeepEqual(expected, devices) {
+		t.Errorf("expected %+v but got %+v", expected, devices)
+	}
+}
+
+func TestSockstatAndSoftnet(t *testing.T) {
+	proc := writeFixture(t, map[string]string{
+		"1/net/sockstat": `sockets: used 120
+TCP: inuse 5 orphan 0 tw 2 alloc 7 mem 1
+UDP: inuse 3 mem 2
+`,
+		"1/net/softnet_stat": `0000002a 00000001 00000002 00000000 00000000 00000000 00000000 00000000 00000003 00000004 00000005
+000000ff 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000003
+`,
+	})
+	sockstat, err := proc.Sockstat()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedSockstat := map[string]map[string]int64{
+		"sockets": {"used": 120},
+		"TCP":     {"inuse": 5, "orphan": 0, "tw": 2, "alloc": 7, "mem": 1},
+		"UDP":     {"inuse": 3, "mem": 2},
+	}
+	if !reflect.DeepEqual(expectedSockstat, sockstat) {
+		t.Errorf("expected sockstat %v but got %v", expectedSockstat, sockstat)
+	}
+
+	softnet, err := proc.SoftnetStat()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedSoftnet := []SoftnetStat{
+		{CPU: 0, Processed: 42, Dropped: 1, TimeSqueeze: 2, CPUCollision: 3, ReceivedRPS: 4, FlowLimitCount: 5},
+		// the second online CPU is CPU 3
+		{CPU: 3, Processed: 255},
+	}
+	if !reflect.DeepEqual(expectedSoftnet, softnet) {
+		t.Errorf("expected softnet %+v but got %+v", expectedSoftnet, softnet)
+	}
+}
+
+func TestConntrack(t *testing.T) {
+	proc := writeFixture(t, map[string]string{
+		"1/net/stat/nf_conntrack": `entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop icmp_error expect_new expect_create expect_delete search_restart
+0000002a  00000000 00000000 00000000 00000003 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000001
+0000002a  00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000
+`,
+		// the count of the network namespace of the agent
+		"sys/net/netfilter/nf_conntrack_count": "3\n",
+		"sys/net/netfilter/nf_conntrack_max":   "262144\n",
+	})
+	conntrack, err := proc.Conntrack()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (Conntrack{Count: 42, Max: 262144}); expected != conntrack {
+		t.Errorf("expected %+v but got %+v", expected, conntrack)
+	}
+
+	invalid := writeFixture(t, map[string]string{
+		"1/net/stat/nf_conntrack":            "searched found\n00000000 00000000\n",
+		"sys/net/netfilter/nf_conntrack_max": "262144\n",
+	})
+	if _, err := invalid.Conntrack(); err == nil {
+		t.Error("expected error parsing a table without entries but got none")
+	}
+
+	// without the nf_conntrack module
+	if _, err := writeFixture(t, nil).Conntrack(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error but got %v", err)
+	}
+}
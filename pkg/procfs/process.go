@@ -0,0 +1,192 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcStat holds the statistics of /proc/<pid>/stat, times are in USER_HZ ticks
+type ProcStat struct {
+	PID        int
+	Comm       string
+	State      string
+	PPID       int
+	MinFlt     uint64
+	MajFlt     uint64
+	UTime      uint64
+	STime      uint64
+	Priority   int64
+	Nice       int64
+	NumThreads int64
+	StartTime  uint64
+	VSize      uint64
+	// RSS is the resident set size in pages
+	RSS int64
+}
+
+// ProcStatus holds the memory and scheduling statistics of /proc/<pid>/status, in bytes
+type ProcStatus struct {
+	Name                     string
+	VmRSS                    uint64
+	VmHWM                    uint64
+	VmSwap                   uint64
+	Threads                  uint64
+	VoluntaryCtxtSwitches    uint64
+	NonvoluntaryCtxtSwitches uint64
+}
+
+// ProcIO holds the IO statistics of /proc/<pid>/io
+type ProcIO struct {
+	RChar               uint64
+	WChar               uint64
+	SyscR               uint64
+	SyscW               uint64
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64
+}
+
+// PIDs returns the pids of the processes, sorted
+func (fs FS) PIDs() ([]int, error) {
+	entries, err := os.ReadDir(fs.root)
+	if err != nil {
+		return nil, err
+	}
+	pids := []int{}
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// ProcStat reads /proc/<pid>/stat
+func (fs FS) ProcStat(pid int) (ProcStat, error) {
+	content, err := fs.readFile(strconv.Itoa(pid), "stat")
+	if err != nil {
+		return ProcStat{}, err
+	}
+	// the command name is between parentheses, and can hold spaces and parentheses
+	text := string(content)
+	open, closing := strings.IndexByte(text, '('), strings.LastIndexByte(text, ')')
+	if open < 0 || closing < open {
+		return ProcStat{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(text[closing+1:])
+	if len(fields) < 22 {
+		return ProcStat{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	// fields starts with the 3rd field of stat, the state
+	u := func(i int) uint64 {
+		v, _ := strconv.ParseUint(fields[i-3], 10, 64)
+		return v
+	}
+	s := func(i int) int64 {
+		v, _ := strconv.ParseInt(fields[i-3], 10, 64)
+		return v
+	}
+	return ProcStat{
+		PID:        pid,
+		Comm:       text[open+1 : closing],
+		State:      fields[0],
+		PPID:       int(s(4)),
+		MinFlt:     u(10),
+		MajFlt:     u(12),
+		UTime:      u(14),
+		STime:      u(15),
+		Priority:   s(18),
+		Nice:       s(19),
+		NumThreads: s(20),
+		StartTime:  u(22),
+		VSize:      u(23),
+		RSS:        s(24),
+	}, nil
+}
+
+// ProcStatus reads /proc/<pid>/status
+func (fs FS) ProcStatus(pid int) (ProcStatus, error) {
+	content, err := fs.readFile(strconv.Itoa(pid), "status")
+	if err != nil {
+		return ProcStatus{}, err
+	}
+	values, err := parseKeyValues(content)
+	if err != nil {
+		return ProcStatus{}, err
+	}
+	u := func(key string) uint64 {
+		v, _ := strconv.ParseUint(values[key], 10, 64)
+		return v
+	}
+	return ProcStatus{
+		Name:                     values["Name"],
+		VmRSS:                    parseKB(values["VmRSS"]),
+		VmHWM:                    parseKB(values["VmHWM"]),
+		VmSwap:                   parseKB(values["VmSwap"]),
+		Threads:                  u("Threads"),
+		VoluntaryCtxtSwitches:    u("voluntary_ctxt_switches"),
+		NonvoluntaryCtxtSwitches: u("nonvoluntary_ctxt_switches"),
+	}, nil
+}
+
+// ProcCmdline reads /proc/<pid>/cmdline, the arguments of the process, empty for kernel threads
+func (fs FS) ProcCmdline(pid int) ([]string, error) {
+	content, err := fs.readFile(strconv.Itoa(pid), "cmdline")
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimSuffix(content, []byte{0})
+	if len(content) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(string(content), "\x00"), nil
+}
+
+// ProcFDs returns the number of open file descriptors of the process, from /proc/<pid>/fd
+func (fs FS) ProcFDs(pid int) (int, error) {
+	entries, err := os.ReadDir(fs.Path(strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// ProcSmapsRollup reads /proc/<pid>/smaps_rollup, the memory of all the mappings of the process
+// such as Rss, Pss, Anonymous or Swap, in bytes
+func (fs FS) ProcSmapsRollup(pid int) (map[string]uint64, error) {
+	content, err := fs.readFile(strconv.Itoa(pid), "smaps_rollup")
+	if err != nil {
+		return nil, err
+	}
+	return parseMemoryValues(content)
+}
+
+// ProcIO reads /proc/<pid>/io, which is only readable by the processes allowed to trace the process
+func (fs FS) ProcIO(pid int) (ProcIO, error) {
+	content, err := fs.readFile(strconv.Itoa(pid), "io")
+	if err != nil {
+		return ProcIO{}, err
+	}
+	values, err := parseKeyValues(content)
+	if err != nil {
+		return ProcIO{}, err
+	}
+	u := func(key string) uint64 {
+		v, _ := strconv.ParseUint(values[key], 10, 64)
+		return v
+	}
+	return ProcIO{
+		RChar:               u("rchar"),
+		WChar:               u("wchar"),
+		SyscR:               u("syscr"),
+		SyscW:               u("syscw"),
+		ReadBytes:           u("read_bytes"),
+		WriteBytes:          u("write_bytes"),
+		CancelledWriteBytes: u("cancelled_write_bytes"),
+	}, nil
+}
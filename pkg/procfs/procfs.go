@@ -0,0 +1,276 @@
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoot is the mount point of procfs
+const DefaultRoot = "/proc"
+
+// FS reads the files of a procfs mounted at its root
+type FS struct {
+	root string
+}
+
+// NewFS returns the procfs mounted at root
+func NewFS(root string) FS {
+	return FS{root: root}
+}
+
+// Root returns the mount point of the procfs
+func (fs FS) Root() string {
+	return fs.root
+}
+
+// Path returns the path of the given file of the procfs
+func (fs FS) Path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// readFile reads the given file of the procfs
+func (fs FS) readFile(elem ...string) ([]byte, error) {
+	/* #nosec G304 the files are read from procfs */
+	return os.ReadFile(fs.Path(elem...))
+}
+
+// CPUStat holds the time spent by a CPU in each mode, in USER_HZ ticks
+type CPUStat struct {
+	User      uint64
+	Nice      uint64
+	System    uint64
+	Idle      uint64
+	IOWait    uint64
+	IRQ       uint64
+	SoftIRQ   uint64
+	Steal     uint64
+	Guest     uint64
+	GuestNice uint64
+}
+
+// Stat holds the kernel and system statistics of /proc/stat
+type Stat struct {
+	// CPUs holds the statistics of each CPU, and of all the CPUs under "cpu"
+	CPUs            map[string]CPUStat
+	Interrupts      uint64
+	ContextSwitches uint64
+	BootTime        uint64
+	Forks           uint64
+	ProcsRunning    uint64
+	ProcsBlocked    uint64
+}
+
+// Stat reads /proc/stat
+func (fs FS) Stat() (Stat, error) {
+	content, err := fs.readFile("stat")
+	if err != nil {
+		return Stat{}, err
+	}
+	stat := Stat{CPUs: map[string]CPUStat{}}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "cpu") {
+			values := parseUints(fields[1:])
+			// older kernels have less fields
+			for len(values) < 10 {
+				values = append(values, 0)
+			}
+			stat.CPUs[fields[0]] = CPUStat{
+				User: values[0], Nice: values[1], System: values[2], Idle: values[3], IOWait: values[4],
+				IRQ: values[5], SoftIRQ: values[6], Steal: values[7], Guest: values[8], GuestNice: values[9],
+			}
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "intr":
+			stat.Interrupts = value
+		case "ctxt":
+			stat.ContextSwitches = value
+		case "btime":
+			stat.BootTime = value
+		case "processes":
+			stat.Forks = value
+		case "procs_running":
+			stat.ProcsRunning = value
+		case "procs_blocked":
+			stat.ProcsBlocked = value
+		}
+	}
+	return stat, scanner.Err()
+}
+
+// Meminfo reads /proc/meminfo, the values are converted from kB to bytes,
+// except the ones without unit such as HugePages_Total
+func (fs FS) Meminfo() (map[string]uint64, error) {
+	content, err := fs.readFile("meminfo")
+	if err != nil {
+		return nil, err
+	}
+	return parseMemoryValues(content)
+}
+
+// Softirqs reads /proc/softirqs, the number of softirqs of each type per CPU
+func (fs FS) Softirqs() (map[string][]uint64, error) {
+	content, err := fs.readFile("softirqs")
+	if err != nil {
+		return nil, err
+	}
+	softirqs := map[string][]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// the first line lists the CPUs
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		softirqs[strings.TrimSuffix(fields[0], ":")] = parseUints(fields[1:])
+	}
+	return softirqs, scanner.Err()
+}
+
+// Interrupt holds the number of interrupts of an IRQ per CPU
+type Interrupt struct {
+	IRQ         string
+	CPUs        []uint64
+	Description string
+}
+
+// Interrupts reads /proc/interrupts
+func (fs FS) Interrupts() ([]Interrupt, error) {
+	content, err := fs.readFile("interrupts")
+	if err != nil {
+		return nil, err
+	}
+	interrupts := []Interrupt{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	if !scanner.Scan() {
+		return interrupts, scanner.Err()
+	}
+	cpus := len(strings.Fields(scanner.Text()))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		irq := Interrupt{IRQ: strings.TrimSuffix(fields[0], ":"), CPUs: []uint64{}}
+		// some lines, such as ERR and MIS, only have a total
+		i := 1
+		for ; i < len(fields) && i <= cpus; i++ {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				break
+			}
+			irq.CPUs = append(irq.CPUs, v)
+		}
+		irq.Description = strings.Join(fields[i:], " ")
+		interrupts = append(interrupts, irq)
+	}
+	return interrupts, scanner.Err()
+}
+
+// DiskStats holds the IO statistics of a block device
+type DiskStats struct {
+	Major            uint64
+	Minor            uint64
+	Device           string
+	ReadsCompleted   uint64
+	ReadsMerged      uint64
+	SectorsRead      uint64
+	ReadTimeMs       uint64
+	WritesCompleted  uint64
+	WritesMerged     uint64
+	SectorsWritten   uint64
+	WriteTimeMs      uint64
+	IOsInProgress    uint64
+	IOTimeMs         uint64
+	WeightedIOTimeMs uint64
+}
+
+// Diskstats reads /proc/diskstats
+func (fs FS) Diskstats() ([]DiskStats, error) {
+	content, err := fs.readFile("diskstats")
+	if err != nil {
+		return nil, err
+	}
+	disks := []DiskStats{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		v := parseUints(append(fields[:2:2], fields[3:14]...))
+		disks = append(disks, DiskStats{
+			Major: v[0], Minor: v[1], Device: fields[2],
+			ReadsCompleted: v[2], ReadsMerged: v[3], SectorsRead: v[4], ReadTimeMs: v[5],
+			WritesCompleted: v[6], WritesMerged: v[7], SectorsWritten: v[8], WriteTimeMs: v[9],
+			IOsInProgress: v[10], IOTimeMs: v[11], WeightedIOTimeMs: v[12],
+		})
+	}
+	return disks, scanner.Err()
+}
+
+// parseUints parses the fields as unsigned integers, invalid fields are 0
+func parseUints(fields []string) []uint64 {
+	values := make([]uint64, len(fields))
+	for i, f := range fields {
+		values[i], _ = strconv.ParseUint(f, 10, 64)
+	}
+	return values
+}
+
+// parseKeyValues parses the "Key: value" lines of the status like files
+func parseKeyValues(content []byte) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to parse: %w", err)
+	}
+	return values, nil
+}
+
+// parseMemoryValues parses the "Name: <value> kB" lines of the meminfo like files, in bytes.
+// The other lines, such as the header of smaps_rollup, are skipped.
+func parseMemoryValues(content []byte) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseKB parses the "<value> kB" values of the status like files, in bytes
+func parseKB(value string) uint64 {
+	v, _ := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+	return v * 1024
+}
@@ -0,0 +1,245 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFixture writes the given files, by path relative to the root, into a temporary procfs
+func writeFixture(t *testing.T, files map[string]string) FS {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewFS(root)
+}
+
+func TestStat(t *testing.T) {
+	fs := writeFixture(t, map[string]string{"stat": `cpu  100 2 30 4000 5 6 7 8 0 0
+cpu0 50 1 15 2000 2 3 4 4 0 0
+cpu1 50 1 15 2000 3 3 3
+intr 12345 0 1 2
+ctxt 6789
+btime 1700000000
+processes 4242
+procs_running 3
+procs_blocked 1
+softirq 100 1 2 3
+`})
+	stat, err := fs.Stat()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Stat{
+		CPUs: map[string]CPUStat{
+			"cpu":  {User: 100, Nice: 2, System: 30, Idle: 4000, IOWait: 5, IRQ: 6, SoftIRQ: 7, Steal: 8},
+			"cpu0": {User: 50, Nice: 1, System: 15, Idle: 2000, IOWait: 2, IRQ: 3, SoftIRQ: 4, Steal: 4},
+			"cpu1": {User: 50, Nice: 1, System: 15, Idle: 2000, IOWait: 3, IRQ: 3, SoftIRQ: 3},
+		},
+		Interrupts:      12345,
+		ContextSwitches: 6789,
+		BootTime:        1700000000,
+		Forks:           4242,
+		ProcsRunning:    3,
+		ProcsBlocked:    1,
+	}
+	if !reflect.DeepEqual(expected, stat) {
+		t.Errorf("expected %+v but got %+v", expected, stat)
+	}
+}
+
+func TestMeminfo(t *testing.T) {
+	fs := writeFixture(t, map[string]string{"meminfo": `MemTotal:       16000000 kB
+MemFree:         8000000 kB
+HugePages_Total:       4
+Invalid:             abc kB
+`})
+	meminfo, err := fs.Meminfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]uint64{
+		"MemTotal":        16000000 * 1024,
+		"MemFree":         8000000 * 1024,
+		"HugePages_Total": 4,
+	}
+	if !reflect.DeepEqual(expected, meminfo) {
+		t.Errorf("expected %v but got %v", expected, meminfo)
+	}
+}
+
+func TestSoftirqsAndInterrupts(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"softirqs": `                    CPU0       CPU1
+          HI:          1          2
+       TIMER:        300        400
+`,
+		"interrupts": `           CPU0       CPU1
+  0:         36          0   IO-APIC   2-edge      timer
+NMI:          5          6   Non-maskable interrupts
+ERR:          0
+`,
+	})
+	softirqs, err := fs.Softirqs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string][]uint64{"HI": {1, 2}, "TIMER": {300, 400}}; !reflect.DeepEqual(expected, softirqs) {
+		t.Errorf("expected softirqs %v but got %v", expected, softirqs)
+	}
+
+	interrupts, err := fs.Interrupts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Interrupt{
+		{IRQ: "0", CPUs: []uint64{36, 0}, Description: "IO-APIC 2-edge timer"},
+		{IRQ: "NMI", CPUs: []uint64{5, 6}, Description: "Non-maskable interrupts"},
+		{IRQ: "ERR", CPUs: []uint64{0}, Description: ""},
+	}
+	if !reflect.DeepEqual(expected, interrupts) {
+		t.Errorf("expected interrupts %+v but got %+v", expected, interrupts)
+	}
+}
+
+func TestDiskstats(t *testing.T) {
+	fs := writeFixture(t, map[string]string{"diskstats": `   8       0 sda 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17
+   8       1 sda1 1 2
+`})
+	disks, err := fs.Diskstats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []DiskStats{{
+		Major: 8, Minor: 0, Device: "sda",
+		ReadsCompleted: 1, ReadsMerged: 2, SectorsRead: 3, ReadTimeMs: 4,
+		WritesCompleted: 5, WritesMerged: 6, SectorsWritten: 7, WriteTimeMs: 8,
+		IOsInProgress: 9, IOTimeMs: 10, WeightedIOTimeMs: 11,
+	}}
+	if !reflect.DeepEqual(expected, disks) {
+		t.Errorf("expected %+v but got %+v", expected, disks)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"42/stat": "42 (my (odd) proc) S 1 42 42 0 -1 4194560 100 0 3 0 250 50 0 0 20 0 12 0 1000 123456789 2048 18446744073709551615\n",
+		"42/status": `Name:	my (odd) proc
+VmHWM:	   10240 kB
+VmRSS:	    8192 kB
+Threads:	12
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	7
+`,
+		"42/io": `rchar: 100
+wchar: 200
+syscr: 3
+syscw: 4
+read_bytes: 4096
+write_bytes: 8192
+cancelled_write_bytes: 0
+`,
+		"7/stat":    "7 (short) R 1\n",
+		"self/stat": "",
+		"uptime":    "",
+	})
+
+	pids, err := fs.PIDs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{7, 42}; !reflect.DeepEqual(expected, pids) {
+		t.Errorf("expected pids %v but got %v", expected, pids)
+	}
+
+	stat, err := fs.ProcStat(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedStat := ProcStat{
+		PID: 42, Comm: "my (odd) proc", State: "S", PPID: 1, MinFlt: 100, MajFlt: 3,
+		UTime: 250, STime: 50, Priority: 20, NumThreads: 12, StartTime: 1000, VSize: 123456789, RSS: 2048,
+	}
+	if !reflect.DeepEqual(expectedStat, stat) {
+		t.Errorf("expected stat %+v but got %+v", expectedStat, stat)
+	}
+	if _, err := fs.ProcStat(7); err == nil {
+		t.Error("expected error parsing a truncated stat but got none")
+	}
+
+	status, err := fs.ProcStatus(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedStatus := ProcStatus{
+		Name: "my (odd) proc", VmRSS: 8192 * 1024, VmHWM: 10240 * 1024, Threads: 12,
+		VoluntaryCtxtSwitches: 150, NonvoluntaryCtxtSwitches: 7,
+	}
+	if !reflect.DeepEqual(expectedStatus, status) {
+		t.Errorf("expected status %+v but got %+v", expectedStatus, status)
+	}
+
+	io, err := fs.ProcIO(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedIO := ProcIO{RChar: 100, WChar: 200, SyscR: 3, SyscW: 4, ReadBytes: 4096, WriteBytes: 8192}
+	if !reflect.DeepEqual(expectedIO, io) {
+		t.Errorf("expected io %+v but got %+v", expectedIO, io)
+	}
+	if _, err := fs.ProcIO(7); err == nil {
+		t.Error("expected error reading a missing io file but got none")
+	}
+}
+
+func TestProcessResources(t *testing.T) {
+	fs := writeFixture(t, map[string]string{
+		"42/cmdline": "/usr/bin/kubelet\x00--config=/etc/kubernetes/kubelet.conf\x00",
+		"42/smaps_rollup": `55d4c2a00000-7ffd8b5f2000 ---p 00000000 00:00 0                          [rollup]
+Rss:                 100 kB
+Pss:                  80 kB
+Swap:                  0 kB
+`,
+		"42/fd/0":   "",
+		"42/fd/1":   "",
+		"42/fd/2":   "",
+		"2/cmdline": "",
+	})
+
+	cmdline, err := fs.ProcCmdline(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"/usr/bin/kubelet", "--config=/etc/kubernetes/kubelet.conf"}; !reflect.DeepEqual(expected, cmdline) {
+		t.Errorf("expected cmdline %q but got %q", expected, cmdline)
+	}
+	// kernel threads have no command line
+	if cmdline, err := fs.ProcCmdline(2); err != nil || len(cmdline) != 0 {
+		t.Errorf("expected empty cmdline but got %q, %v", cmdline, err)
+	}
+
+	fds, err := fs.ProcFDs(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fds != 3 {
+		t.Errorf("expected 3 fds but got %d", fds)
+	}
+
+	smaps, err := fs.ProcSmapsRollup(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]uint64{"Rss": 100 * 1024, "Pss": 80 * 1024, "Swap": 0}; !reflect.DeepEqual(expected, smaps) {
+		t.Errorf("expected smaps_rollup %v but got %v", expected, smaps)
+	}
+}
@@ -13,15 +13,45 @@ const (
 	CrioRun      RunType = "CRIO"
 	UnknownRun   RunType = "Unknown"
 	ScriptingRun RunType = "Scripting"
+	TraceRun     RunType = "Trace"
+	PprofRun     RunType = "Pprof"
+	SystemRun    RunType = "System"
+	NetworkRun   RunType = "Network"
+	ProcessRun   RunType = "Process"
+	PodRun       RunType = "Pod"
 )
 
-// ExecutionRun holds the status of a CRIO, Kubelet Profiling and scripting execution
+// FailureReason tells why an execution run failed, when it needs to be told apart from other errors
+type FailureReason string
+
+const (
+	// IntegrityFailure is the reason of the scripts not run as their digest isn't the expected one
+	IntegrityFailure FailureReason = "IntegrityCheckFailed"
+)
+
+// ExecutionRun holds the status of a CRIO, Kubelet Profiling and scripting execution.
+// Its optional fields are omitted from the JSON of the runs when they are empty.
 type ExecutionRun struct {
 	Type       RunType
+	Target     string `json:",omitempty"`
+	Profile    string `json:",omitempty"`
 	Successful bool
-	BeginTime  time.Time
-	EndTime    time.Time
-	Error      string
+	// Cancelled is true if the execution run was stopped by the cancellation of the run
+	Cancelled bool `json:",omitempty"`
+	BeginTime time.Time
+	EndTime   time.Time
+	Error     string
+	// FailureReason is set for the errors which need to be told apart
+	FailureReason FailureReason `json:",omitempty"`
+	// ExitCode is the exit code of a script, -1 if it was killed by a signal
+	ExitCode int `json:",omitempty"`
+	// Signal is the name of the signal which killed a script
+	Signal string `json:",omitempty"`
+	// StdoutBytes and StderrBytes are the sizes of the outputs of a script
+	StdoutBytes int64 `json:",omitempty"`
+	StderrBytes int64 `json:",omitempty"`
+	// LimitViolations lists the resource limits a script exceeded
+	LimitViolations []string `json:",omitempty"`
 }
 
 // Run holds the status of a request to the node observability agent
@@ -29,3 +59,45 @@ type Run struct {
 	ID            uuid.UUID
 	ExecutionRuns []ExecutionRun
 }
+
+// BeginTime returns the earliest begin time of the execution runs
+func (r Run) BeginTime() time.Time {
+	begin := time.Time{}
+	for _, er := range r.ExecutionRuns {
+		if begin.IsZero() || er.BeginTime.Before(begin) {
+			begin = er.BeginTime
+		}
+	}
+	return begin
+}
+
+// EndTime returns the latest end time of the execution runs
+func (r Run) EndTime() time.Time {
+	end := time.Time{}
+	for _, er := range r.ExecutionRuns {
+		if er.EndTime.After(end) {
+			end = er.EndTime
+		}
+	}
+	return end
+}
+
+// Successful returns true if the run has execution runs and all of them were successful
+func (r Run) Successful() bool {
+	for _, er := range r.ExecutionRuns {
+		if !er.Successful {
+			return false
+		}
+	}
+	return len(r.ExecutionRuns) > 0
+}
+
+// HasType returns true if one of the execution runs is of the given type
+func (r Run) HasType(t RunType) bool {
+	for _, er := range r.ExecutionRuns {
+		if er.Type == t {
+			return true
+		}
+	}
+	return false
+}
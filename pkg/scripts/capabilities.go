@@ -0,0 +1,107 @@
+package scripts
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procSelfStatus holds the capabilities of the agent
+const procSelfStatus = "/proc/self/status"
+
+// capabilities maps the names of the linux capabilities, without the CAP_ prefix, to their bit
+var capabilities = map[string]uint{
+	"CHOWN":              0,
+	"DAC_OVERRIDE":       1,
+	"DAC_READ_SEARCH":    2,
+	"FOWNER":             3,
+	"FSETID":             4,
+	"KILL":               5,
+	"SETGID":             6,
+	"SETUID":             7,
+	"SETPCAP":            8,
+	"LINUX_IMMUTABLE":    9,
+	"NET_BIND_SERVICE":   10,
+	"NET_BROADCAST":      11,
+	"NET_ADMIN":          12,
+	"NET_RAW":            13,
+	"IPC_LOCK":           14,
+	"IPC_OWNER":          15,
+	"SYS_MODULE":         16,
+	"SYS_RAWIO":          17,
+	"SYS_CHROOT":         18,
+	"SYS_PTRACE":         19,
+	"SYS_PACCT":          20,
+	"SYS_ADMIN":          21,
+	"SYS_BOOT":           22,
+	"SYS_NICE":           23,
+	"SYS_RESOURCE":       24,
+	"SYS_TIME":           25,
+	"SYS_TTY_CONFIG":     26,
+	"MKNOD":              27,
+	"LEASE":              28,
+	"AUDIT_WRITE":        29,
+	"AUDIT_CONTROL":      30,
+	"SETFCAP":            31,
+	"MAC_OVERRIDE":       32,
+	"MAC_ADMIN":          33,
+	"SYSLOG":             34,
+	"WAKE_ALARM":         35,
+	"BLOCK_SUSPEND":      36,
+	"AUDIT_READ":         37,
+	"PERFMON":            38,
+	"BPF":                39,
+	"CHECKPOINT_RESTORE": 40,
+}
+
+// MissingCapabilities returns the capabilities required by the script
+// which are not in the effective capabilities of the agent
+func (s Script) MissingCapabilities() ([]string, error) {
+	return s.missingCapabilities(procSelfStatus)
+}
+
+func (s Script) missingCapabilities(statusFile string) ([]string, error) {
+	if len(s.Capabilities) == 0 {
+		return nil, nil
+	}
+	effective, err := effectiveCapabilities(statusFile)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, c := range s.Capabilities {
+		if effective&(1<<capabilities[c]) == 0 {
+			missing = append(missing, c)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// effectiveCapabilities reads the CapEff bitmask of the given /proc/<pid>/status file
+func effectiveCapabilities(statusFile string) (uint64, error) {
+	/* #nosec G304 the status file is the one of the agent process */
+	f, err := os.Open(statusFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "CapEff:") {
+			caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unable to parse the effective capabilities of %s: %w", statusFile, err)
+			}
+			return caps, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no effective capabilities found in %s", statusFile)
+}
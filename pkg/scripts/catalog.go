@@ -0,0 +1,199 @@
+package scripts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// CatalogFile is the manifest of the catalog, in the catalog folder
+	CatalogFile = "catalog.json"
+	// DefaultTimeoutSeconds is the timeout of the scripts not declaring one
+	DefaultTimeoutSeconds = 7200
+	// MaxTimeoutSeconds is the highest timeout a script can declare
+	MaxTimeoutSeconds = 86400
+)
+
+// scriptNameRegexp restricts script names to what can safely be used in file names and URLs
+var scriptNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Script is a script of the catalog, which can be run by name
+type Script struct {
+	// Name of the script, used in scripting requests
+	Name string
+	// File is the name of the script file, in the catalog folder
+	File        string
+	Description string
+	// TimeoutSeconds is the time after which the script is killed, defaults to 7200 seconds
+	TimeoutSeconds int
+	// Capabilities are the capabilities the agent must have to run the script, such as NET_ADMIN
+	Capabilities []string
+	// Parameters are the values which can be set in the scripting requests
+	Parameters []Parameter
+	// Runtime names the int and duration parameters whose product is the time the script runs in
+	// seconds, such as DELAY and ITERATIONS: the values which wouldn't let the script finish before
+	// its timeout are rejected
+	Runtime []string
+	// Limits are the resource limits and priorities of the script
+	Limits Limits
+	// Helpers are the names of the files of the catalog folder run by the script, such as monitor.sh,
+	// which the script finds next to itself: they are verified along with the script
+	Helpers []string
+	// path is the full path of the script file
+	path string
+	// helperPaths are the full paths of the helpers
+	helperPaths []string
+}
+
+// Path returns the full path of the script file
+func (s Script) Path() string {
+	return s.path
+}
+
+// HelperPaths returns the full paths of the helpers of the script
+func (s Script) HelperPaths() []string {
+	return s.helperPaths
+}
+
+// Timeout returns the timeout of the script in seconds
+func (s Script) Timeout() int {
+	if s.TimeoutSeconds == 0 {
+		return DefaultTimeoutSeconds
+	}
+	return s.TimeoutSeconds
+}
+
+// Catalog holds the scripts which can be run by name
+type Catalog struct {
+	Scripts []Script
+}
+
+// LoadCatalog reads the catalog.json manifest of the given folder, listing the
+// scripts of the folder which can be run. The paths of the scripts are absolute,
+// as the scripts run in their own output directories.
+func LoadCatalog(folder string) (*Catalog, error) {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+	manifest := filepath.Join(folder, CatalogFile)
+	/* #nosec G304 the catalog folder is a parameter of the agent, its scripts are part of the agent image */
+	content, err := os.ReadFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{}
+	if err := json.Unmarshal(content, catalog); err != nil {
+		return nil, fmt.Errorf("unable to decode script catalog %s: %w", manifest, err)
+	}
+
+	names := map[string]bool{}
+	for i := range catalog.Scripts {
+		s := &catalog.Scripts[i]
+		if err := s.validate(folder); err != nil {
+			return nil, fmt.Errorf("invalid script %q in %s: %w", s.Name, manifest, err)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("script %q declared twice in %s", s.Name, manifest)
+		}
+		names[s.Name] = true
+	}
+	return catalog, nil
+}
+
+// validate checks the declaration of the script and
+// that its file is a regular file of the catalog folder
+func (s *Script) validate(folder string) error {
+	if !scriptNameRegexp.MatchString(s.Name) {
+		return fmt.Errorf("name must consist of lower case alphanumeric characters or '-'")
+	}
+	if !isFolderFile(s.File) {
+		return fmt.Errorf("file must be the name of a file of the catalog folder")
+	}
+	for _, h := range s.Helpers {
+		if !isFolderFile(h) || h == s.File {
+			return fmt.Errorf("helper %q must be the name of another file of the catalog folder", h)
+		}
+	}
+	if s.TimeoutSeconds < 0 || s.TimeoutSeconds > MaxTimeoutSeconds {
+		return fmt.Errorf("timeout must be between 1 and %d seconds", MaxTimeoutSeconds)
+	}
+	for _, c := range s.Capabilities {
+		if _, ok := capabilities[c]; !ok {
+			return fmt.Errorf("unknown capability %q", c)
+		}
+	}
+	if err := s.Limits.validate(); err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+	parameters := map[string]bool{}
+	for _, p := range s.Parameters {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid parameter %q: %w", p.Name, err)
+		}
+		if parameters[p.Name] {
+			return fmt.Errorf("parameter %q declared twice", p.Name)
+		}
+		parameters[p.Name] = true
+	}
+	for _, name := range s.Runtime {
+		p, ok := s.parameter(name)
+		if !ok || p.Type == EnumParameter {
+			return fmt.Errorf("runtime parameter %q must be a declared int or duration parameter", name)
+		}
+	}
+
+	s.path = filepath.Join(folder, s.File)
+	if err := checkRegularFile(s.path); err != nil {
+		return err
+	}
+	s.helperPaths = nil
+	for _, h := range s.Helpers {
+		path := filepath.Join(folder, h)
+		if err := checkRegularFile(path); err != nil {
+			return err
+		}
+		s.helperPaths = append(s.helperPaths, path)
+	}
+	return nil
+}
+
+// isFolderFile returns whether name is the name of a file of the catalog folder
+func isFolderFile(name string) bool {
+	return name != "" && name == filepath.Base(name) && name != "." && name != ".."
+}
+
+// checkRegularFile returns an error if path isn't a regular file
+func checkRegularFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return nil
+}
+
+// parameter returns the parameter of the given name
+func (s Script) parameter(name string) (Parameter, bool) {
+	for _, p := range s.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// Get returns the script of the given name
+func (c *Catalog) Get(name string) (Script, bool) {
+	for _, s := range c.Scripts {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Script{}, false
+}
@@ -0,0 +1,194 @@
+package scripts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeCatalog(t *testing.T, manifest string, files ...string) string {
+	dir := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("#!/bin/sh\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, CatalogFile), []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadCatalog(t *testing.T) {
+	testCases := []struct {
+		name          string
+		manifest      string
+		files         []string
+		expectedError bool
+	}{
+		{
+			name:     "valid catalog",
+			manifest: `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Description":"metrics","TimeoutSeconds":60,"Capabilities":["NET_ADMIN"],"Helpers":["monitor.sh"]},{"Name":"sleep","File":"sleep.sh"}]}`,
+			files:    []string{"metrics.sh", "monitor.sh", "sleep.sh"},
+		},
+		{
+			name:          "invalid name",
+			manifest:      `{"Scripts":[{"Name":"Metrics!","File":"metrics.sh"}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "duplicated name",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh"},{"Name":"metrics","File":"metrics.sh"}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "file outside of the catalog folder",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"../metrics.sh"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "missing file",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "helper outside of the catalog folder",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Helpers":["../monitor.sh"]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "missing helper",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Helpers":["monitor.sh"]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "timeout out of range",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","TimeoutSeconds":-1}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "unknown capability",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Capabilities":["CAP_NET_ADMIN"]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "invalid parameter",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Parameters":[{"Name":"DELAY","Type":"duration","Default":"soon"}]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "duplicated parameter",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Parameters":[{"Name":"DELAY","Type":"duration"},{"Name":"DELAY","Type":"int"}]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "undeclared runtime parameter",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Parameters":[{"Name":"DELAY","Type":"duration"}],"Runtime":["DELAY","ITERATIONS"]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "enum runtime parameter",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Parameters":[{"Name":"MODE","Type":"enum","Values":["fast"]}],"Runtime":["MODE"]}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "invalid limits",
+			manifest:      `{"Scripts":[{"Name":"metrics","File":"metrics.sh","Limits":{"Nice":-20}}]}`,
+			files:         []string{"metrics.sh"},
+			expectedError: true,
+		},
+		{
+			name:          "invalid manifest",
+			manifest:      `{"Scripts":`,
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeCatalog(t, tc.manifest, tc.files...)
+			catalog, err := LoadCatalog(dir)
+			if tc.expectedError {
+				if err == nil {
+					t.Error("expected error but there were none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s, ok := catalog.Get("metrics")
+			if !ok {
+				t.Fatal("expected script metrics to be part of the catalog")
+			}
+			if s.Path() != filepath.Join(dir, "metrics.sh") || s.Timeout() != 60 {
+				t.Errorf("unexpected path %s or timeout %d", s.Path(), s.Timeout())
+			}
+			if expected := []string{filepath.Join(dir, "monitor.sh")}; !reflect.DeepEqual(expected, s.HelperPaths()) {
+				t.Errorf("expected helpers %v but got %v", expected, s.HelperPaths())
+			}
+			if s, _ := catalog.Get("sleep"); s.Timeout() != DefaultTimeoutSeconds {
+				t.Errorf("expected default timeout but got %d", s.Timeout())
+			}
+			if _, ok := catalog.Get("unknown"); ok {
+				t.Error("expected unknown script not to be part of the catalog")
+			}
+		})
+	}
+}
+
+func TestShippedCatalog(t *testing.T) {
+	catalog, err := LoadCatalog("../../scripts/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"metrics", "network-metrics"} {
+		s, ok := catalog.Get(name)
+		if !ok {
+			t.Errorf("expected script %s in the catalog", name)
+			continue
+		}
+		if !filepath.IsAbs(s.Path()) {
+			t.Errorf("expected the absolute path of %s but got %s", name, s.Path())
+		}
+		// the default values fit in the timeout
+		if _, err := s.Env(map[string]string{}); err != nil {
+			t.Errorf("unexpected error with the default values of %s: %v", name, err)
+		}
+	}
+	s, _ := catalog.Get("network-metrics")
+	if _, err := s.Env(map[string]string{"DELAY": "60s", "ITERATIONS": "720"}); err == nil {
+		t.Error("expected the values of network-metrics running beyond its timeout to be rejected")
+	}
+}
+
+func TestMissingCapabilities(t *testing.T) {
+	status := filepath.Join(t.TempDir(), "status")
+	// CHOWN, NET_ADMIN and SYS_ADMIN
+	if err := os.WriteFile(status, []byte("Name:\tagent\nCapInh:\t0000000000000000\nCapEff:\t0000000000201001\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Script{Capabilities: []string{"SYS_PTRACE", "NET_ADMIN", "BPF", "SYS_ADMIN"}}
+	missing, err := s.missingCapabilities(status)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"BPF", "SYS_PTRACE"}) {
+		t.Errorf("expected BPF and SYS_PTRACE to be missing but got %v", missing)
+	}
+
+	if _, err := (Script{Capabilities: []string{"BPF"}}).missingCapabilities(filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Error("expected error reading a missing status file")
+	}
+}
@@ -0,0 +1,176 @@
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SignatureExt is the extension of the signature of the digests file, next to it
+const SignatureExt = ".sig"
+
+var (
+	// ErrNotAllowed is returned when a script is not part of the allowlist
+	ErrNotAllowed = errors.New("script not part of the allowlist")
+	// ErrTampered is returned when the digest of a script differs from the allowlist
+	ErrTampered = errors.New("script digest mismatch")
+)
+
+// Allowlist holds the SHA-256 digests of the scripts which can be run
+type Allowlist struct {
+	// digests are the hex encoded digests of the scripts, by absolute path
+	digests map[string]string
+}
+
+// LoadAllowlist reads the digests file, in the format of sha256sum: one "<digest>  <absolute path>"
+// line per script. If publicKeyFile is set, the digests file must be signed by its ed25519 key:
+// the signature is read from the digests file name followed by .sig.
+func LoadAllowlist(digestsFile, publicKeyFile string) (*Allowlist, error) {
+	/* #nosec G304 the digests file is a parameter of the agent */
+	content, err := os.ReadFile(digestsFile)
+	if err != nil {
+		return nil, err
+	}
+	if publicKeyFile != "" {
+		if err := verifySignature(content, digestsFile+SignatureExt, publicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &Allowlist{digests: map[string]string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %d of %s, expected <digest> <path>", line, digestsFile)
+		}
+		digest, path := strings.ToLower(fields[0]), strings.TrimPrefix(fields[1], "*")
+		if d, err := hex.DecodeString(digest); err != nil || len(d) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 digest on line %d of %s", line, digestsFile)
+		}
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("path %s on line %d of %s is not absolute", path, line, digestsFile)
+		}
+		a.digests[filepath.Clean(path)] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Verify checks that the SHA-256 digest of the script file is the one of the allowlist.
+// It returns an error wrapping ErrNotAllowed or ErrTampered if the script can't be run.
+func (a *Allowlist) Verify(path string) error {
+	_, err := a.read(path)
+	return err
+}
+
+// Helpers returns the other scripts of the allowlist in the folder of the script at path,
+// which the script can run as its helpers.
+func (a *Allowlist) Helpers(path string) []string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	helpers := []string{}
+	for p := range a.digests {
+		if p != abs && filepath.Dir(p) == filepath.Dir(abs) {
+			helpers = append(helpers, p)
+		}
+	}
+	sort.Strings(helpers)
+	return helpers
+}
+
+// Stage verifies the script files and writes their verified content to dir, under their base names.
+// Running the copies instead of the script files, the scripts run are exactly the ones verified,
+// even if the files change after their verification: dir must only be writable by the agent.
+func (a *Allowlist) Stage(dir string, paths ...string) error {
+	for _, path := range paths {
+		content, err := a.read(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the content of the script file, once its digest is checked against the allowlist
+func (a *Allowlist) read(path string) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	expected, ok := a.digests[abs]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotAllowed, abs)
+	}
+	/* #nosec G304 the path is part of the allowlist */
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return nil, fmt.Errorf("%w: %s has digest %s, expected %s", ErrTampered, abs, actual, expected)
+	}
+	return content, nil
+}
+
+// verifySignature checks the ed25519 signature of content. The public key is PEM encoded,
+// and the signature either raw or base64 encoded.
+func verifySignature(content []byte, signatureFile, publicKeyFile string) error {
+	/* #nosec G304 the public key file is a parameter of the agent */
+	keyPEM, err := os.ReadFile(publicKeyFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("no PEM encoded public key in %s", publicKeyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("unable to parse the public key of %s: %w", publicKeyFile, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("the public key of %s is not an ed25519 key", publicKeyFile)
+	}
+
+	/* #nosec G304 the signature is next to the digests file */
+	signature, err := os.ReadFile(signatureFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the signature of the digests: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid signature %s: %w", signatureFile, err)
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(publicKey, content, signature) {
+		return fmt.Errorf("invalid signature %s of the digests", signatureFile)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package scripts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSignedDigests writes the digests file of the scripts, its signature and the public key
+func writeSignedDigests(t *testing.T, dir string, scripts map[string]string) (string, string, ed25519.PrivateKey) {
+	digests := ""
+	for name, contents := range scripts {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(contents))
+		digests += hex.EncodeToString(sum[:]) + "  " + path + "\n"
+	}
+	digestsFile := filepath.Join(dir, "digests.sha256")
+	if err := os.WriteFile(digestsFile, []byte(digests), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(digests)))
+	if err := os.WriteFile(digestsFile+SignatureExt, []byte(signature), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return digestsFile, keyFile, privateKey
+}
+
+func TestAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	digestsFile, keyFile, _ := writeSignedDigests(t, dir, map[string]string{"metrics.sh": "echo metrics\n", "network.sh": "echo network\n"})
+	if err := os.WriteFile(filepath.Join(dir, "other.sh"), []byte("echo other\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	allowlist, err := LoadAllowlist(digestsFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := allowlist.Verify(filepath.Join(dir, "metrics.sh")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := allowlist.Verify(filepath.Join(dir, "other.sh")); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected script not to be allowed but got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "network.sh"), []byte("echo network; curl evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := allowlist.Verify(filepath.Join(dir, "network.sh")); !errors.Is(err, ErrTampered) {
+		t.Errorf("expected script to be tampered but got %v", err)
+	}
+}
+
+func TestAllowlistHelpers(t *testing.T) {
+	dir := t.TempDir()
+	digestsFile, _, _ := writeSignedDigests(t, dir, map[string]string{"network.sh": "sh monitor.sh\n", "monitor.sh": "echo monitor\n"})
+	other := filepath.Join(t.TempDir(), "other.sh")
+	content, err := os.ReadFile(digestsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = append(content, []byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  "+other+"\n")...)
+	if err := os.WriteFile(digestsFile, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := LoadAllowlist(digestsFile, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the scripts of other folders aren't helpers
+	if expected := []string{filepath.Join(dir, "monitor.sh")}; !reflect.DeepEqual(expected, allowlist.Helpers(filepath.Join(dir, "network.sh"))) {
+		t.Errorf("expected helpers %v but got %v", expected, allowlist.Helpers(filepath.Join(dir, "network.sh")))
+	}
+	if helpers := allowlist.Helpers(other); len(helpers) != 0 {
+		t.Errorf("expected no helpers but got %v", helpers)
+	}
+}
+
+func TestAllowlistStage(t *testing.T) {
+	dir := t.TempDir()
+	digestsFile, _, _ := writeSignedDigests(t, dir, map[string]string{"network.sh": "sh monitor.sh\n", "monitor.sh": "echo monitor\n"})
+	allowlist, err := LoadAllowlist(digestsFile, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	staged := t.TempDir()
+	if err := allowlist.Stage(staged, filepath.Join(dir, "network.sh"), filepath.Join(dir, "monitor.sh")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the copies keep the verified content when the files change
+	if err := os.WriteFile(filepath.Join(dir, "monitor.sh"), []byte("echo monitor; curl evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"network.sh": "sh monitor.sh\n", "monitor.sh": "echo monitor\n"} {
+		content, err := os.ReadFile(filepath.Join(staged, name))
+		if err != nil || string(content) != expected {
+			t.Errorf("expected the verified content of %s but got %q: %v", name, content, err)
+		}
+	}
+
+	if err := allowlist.Stage(t.TempDir(), filepath.Join(dir, "network.sh"), filepath.Join(dir, "monitor.sh")); !errors.Is(err, ErrTampered) {
+		t.Errorf("expected the helper to be tampered but got %v", err)
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	testCases := []struct {
+		name          string
+		digests       string
+		signed        bool
+		tamper        bool
+		expectedError bool
+	}{
+		{
+			name:    "unsigned digests",
+			digests: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/scripts/empty.sh\n# comment\n",
+		},
+		{
+			name:    "binary mode of sha256sum",
+			digests: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 */tmp/scripts/empty.sh\n",
+		},
+		{
+			name:          "relative path",
+			digests:       "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty.sh\n",
+			expectedError: true,
+		},
+		{
+			name:          "invalid digest",
+			digests:       "e3b0c442  /tmp/scripts/empty.sh\n",
+			expectedError: true,
+		},
+		{
+			name:    "signed digests",
+			digests: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/scripts/empty.sh\n",
+			signed:  true,
+		},
+		{
+			name:          "digests modified after signing",
+			digests:       "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/scripts/empty.sh\n",
+			signed:        true,
+			tamper:        true,
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			digestsFile := filepath.Join(dir, "digests.sha256")
+			keyFile := ""
+			if tc.signed {
+				var privateKey ed25519.PrivateKey
+				digestsFile, keyFile, privateKey = writeSignedDigests(t, dir, nil)
+				signature := ed25519.Sign(privateKey, []byte(tc.digests))
+				if err := os.WriteFile(digestsFile+SignatureExt, signature, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			digests := tc.digests
+			if tc.tamper {
+				digests += "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/evil.sh\n"
+			}
+			if err := os.WriteFile(digestsFile, []byte(digests), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadAllowlist(digestsFile, keyFile)
+			if tc.expectedError && err == nil {
+				t.Error("expected error but there were none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
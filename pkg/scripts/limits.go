@@ -0,0 +1,235 @@
+package scripts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// BestEffortIOClass is the default IO scheduling class, whose priority is set by IOPriority
+	BestEffortIOClass = "best-effort"
+	// IdleIOClass only gets disk time when no other process needs it
+	IdleIOClass = "idle"
+
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioWhoProcess = 1
+)
+
+// cpuMaxRegexp matches the values of the cpu.max file of cgroup v2: $MAX [$PERIOD]
+var cpuMaxRegexp = regexp.MustCompile(`^(max|[1-9][0-9]*)( [1-9][0-9]*)?$`)
+
+// Limits are the resource limits and priorities applied to a script when it starts,
+// and inherited by the processes it spawns. Zero values leave the limits of the agent.
+type Limits struct {
+	// Nice lowers the CPU priority of the script, from 0 to 19
+	Nice int
+	// IOClass is the IO scheduling class of the script, best-effort or idle
+	IOClass string
+	// IOPriority is the priority of the best-effort IO class, from 0 (highest) to 7
+	IOPriority int
+	// AddressSpaceBytes, OpenFiles and FileSizeBytes are the RLIMIT_AS,
+	// RLIMIT_NOFILE and RLIMIT_FSIZE limits of the script
+	AddressSpaceBytes uint64
+	OpenFiles         uint64
+	FileSizeBytes     uint64
+	// CPUMax and MemoryMaxBytes are the cpu.max and memory.max of the dedicated
+	// cgroup v2 of the script, such as "50000 100000" for half a CPU
+	CPUMax         string
+	MemoryMaxBytes int64
+}
+
+// validate checks the values of the limits
+func (l Limits) validate() error {
+	if l.Nice < 0 || l.Nice > 19 {
+		return fmt.Errorf("nice %d out of range [0, 19]", l.Nice)
+	}
+	switch l.IOClass {
+	case "", BestEffortIOClass:
+		if l.IOPriority < 0 || l.IOPriority > 7 {
+			return fmt.Errorf("IO priority %d out of range [0, 7]", l.IOPriority)
+		}
+	case IdleIOClass:
+		if l.IOPriority != 0 {
+			return fmt.Errorf("IO priority can only be set for the %s IO class", BestEffortIOClass)
+		}
+	default:
+		return fmt.Errorf("unknown IO class %q, expected %s or %s", l.IOClass, BestEffortIOClass, IdleIOClass)
+	}
+	if l.CPUMax != "" && !cpuMaxRegexp.MatchString(l.CPUMax) {
+		return fmt.Errorf("invalid cpu.max %q, expected $MAX [$PERIOD]", l.CPUMax)
+	}
+	if l.MemoryMaxBytes < 0 {
+		return fmt.Errorf("invalid memory.max %d", l.MemoryMaxBytes)
+	}
+	return nil
+}
+
+// NeedsCgroup returns true if the limits are enforced by a dedicated cgroup
+func (l Limits) NeedsCgroup() bool {
+	return l.CPUMax != "" || l.MemoryMaxBytes > 0
+}
+
+// Apply sets the priorities and the rlimits of the process of the given pid.
+func (l Limits) Apply(pid int) error {
+	if l.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, l.Nice); err != nil {
+			return fmt.Errorf("unable to set nice %d: %w", l.Nice, err)
+		}
+	}
+	if l.IOClass != "" {
+		prio := ioprioClassBE<<ioprioClassShift | l.IOPriority
+		if l.IOClass == IdleIOClass {
+			prio = ioprioClassIdle << ioprioClassShift
+		}
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio)); errno != 0 {
+			return fmt.Errorf("unable to set the %s IO class: %w", l.IOClass, errno)
+		}
+	}
+	for _, rl := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{name: "address space", resource: unix.RLIMIT_AS, value: l.AddressSpaceBytes},
+		{name: "open files", resource: unix.RLIMIT_NOFILE, value: l.OpenFiles},
+		{name: "file size", resource: unix.RLIMIT_FSIZE, value: l.FileSizeBytes},
+	} {
+		if rl.value == 0 {
+			continue
+		}
+		limit := unix.Rlimit{Cur: rl.value, Max: rl.value}
+		if err := unix.Prlimit(pid, rl.resource, &limit, nil); err != nil {
+			return fmt.Errorf("unable to set the %s limit to %d: %w", rl.name, rl.value, err)
+		}
+	}
+	return nil
+}
+
+// Violations returns the limits exceeded by a script, given the name of the signal which killed
+// it or its exit code, as shells exit with 128 + the signal number of their last command.
+// Exceeding the address space and open files limits makes the system calls of the script fail
+// with ENOMEM and EMFILE instead, which can't be told apart from their other causes.
+func (l Limits) Violations(signal string, exitCode int) []string {
+	violations := []string{}
+	if l.FileSizeBytes > 0 && (signal == unix.SignalName(unix.SIGXFSZ) || exitCode == 128+int(unix.SIGXFSZ)) {
+		violations = append(violations, fmt.Sprintf("file size limit of %d bytes exceeded", l.FileSizeBytes))
+	}
+	return violations
+}
+
+// Cgroup is the cgroup v2 of a script
+type Cgroup struct {
+	path string
+}
+
+// NewCgroup creates the cgroup of the given name under the parent cgroup directory,
+// and sets its cpu.max and memory.max. The cpu and memory controllers must be
+// enabled in the cgroup.subtree_control of the parent.
+func NewCgroup(parent, name string, l Limits) (*Cgroup, error) {
+	if parent == "" {
+		return nil, fmt.Errorf("no parent cgroup configured")
+	}
+	cg := &Cgroup{path: filepath.Join(parent, name)}
+	if err := os.Mkdir(cg.path, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create cgroup %s: %w", cg.path, err)
+	}
+	if l.CPUMax != "" {
+		if err := cg.write("cpu.max", l.CPUMax); err != nil {
+			_ = cg.Remove()
+			return nil, err
+		}
+	}
+	if l.MemoryMaxBytes > 0 {
+		if err := cg.write("memory.max", strconv.FormatInt(l.MemoryMaxBytes, 10)); err != nil {
+			_ = cg.Remove()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// Add moves the process of the given pid to the cgroup
+func (cg *Cgroup) Add(pid int) error {
+	return cg.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// Violations returns the limits of the cgroup which were hit: the allocations beyond memory.max
+// failing after reclaim, along with the processes killed by the OOM killer, and the periods
+// throttled by cpu.max.
+func (cg *Cgroup) Violations() ([]string, error) {
+	violations := []string{}
+	events, err := cg.readKeyValues("memory.events")
+	if err != nil {
+		return nil, err
+	}
+	if events["oom"] > 0 || events["oom_kill"] > 0 {
+		violations = append(violations, fmt.Sprintf("memory.max exceeded %d times, %d processes killed", events["oom"], events["oom_kill"]))
+	}
+	stat, err := cg.readKeyValues("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	if stat["nr_throttled"] > 0 {
+		throttled := time.Duration(stat["throttled_usec"]) * time.Microsecond
+		violations = append(violations, fmt.Sprintf("cpu.max throttled %d periods, for %s", stat["nr_throttled"], throttled))
+	}
+	return violations, nil
+}
+
+// Remove kills the processes left in the cgroup, and removes it
+func (cg *Cgroup) Remove() error {
+	// cgroup.kill is only available from Linux 5.14
+	_ = cg.write("cgroup.kill", "1")
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = syscall.Rmdir(cg.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("unable to remove cgroup %s: %w", cg.path, err)
+}
+
+func (cg *Cgroup) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(cg.path, file), []byte(value), 0600); err != nil {
+		return fmt.Errorf("unable to write %s of cgroup %s: %w", file, cg.path, err)
+	}
+	return nil
+}
+
+// readKeyValues reads the flat keyed files of cgroup v2, missing files are empty
+func (cg *Cgroup) readKeyValues(file string) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	f, err := os.Open(filepath.Join(cg.path, file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,174 @@
+package scripts
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestLimitsValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		limits        Limits
+		expectedError bool
+	}{
+		{
+			name:   "no limits",
+			limits: Limits{},
+		},
+		{
+			name:   "all limits",
+			limits: Limits{Nice: 10, IOClass: BestEffortIOClass, IOPriority: 7, AddressSpaceBytes: 1 << 30, OpenFiles: 1024, FileSizeBytes: 1 << 30, CPUMax: "50000 100000", MemoryMaxBytes: 1 << 30},
+		},
+		{
+			name:   "idle IO class and unbounded cpu.max",
+			limits: Limits{IOClass: IdleIOClass, CPUMax: "max"},
+		},
+		{
+			name:          "negative nice",
+			limits:        Limits{Nice: -5},
+			expectedError: true,
+		},
+		{
+			name:          "realtime IO class",
+			limits:        Limits{IOClass: "realtime"},
+			expectedError: true,
+		},
+		{
+			name:          "IO priority out of range",
+			limits:        Limits{IOClass: BestEffortIOClass, IOPriority: 8},
+			expectedError: true,
+		},
+		{
+			name:          "IO priority of the idle class",
+			limits:        Limits{IOClass: IdleIOClass, IOPriority: 1},
+			expectedError: true,
+		},
+		{
+			name:          "invalid cpu.max",
+			limits:        Limits{CPUMax: "50%"},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.limits.validate()
+			if tc.expectedError && err == nil {
+				t.Error("expected error but there were none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitsApply(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	pid := cmd.Process.Pid
+
+	l := Limits{Nice: 10, IOClass: IdleIOClass, OpenFiles: 64, FileSizeBytes: 4096}
+	if err := l.Apply(pid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nice value is the 19th field, the 17th after the command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if fields[16] != "10" {
+		t.Errorf("expected nice 10 but got %s", fields[16])
+	}
+	prio, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 || prio>>ioprioClassShift != ioprioClassIdle {
+		t.Errorf("expected the idle IO class but got %d: %v", prio>>ioprioClassShift, errno)
+	}
+	for resource, expected := range map[int]uint64{unix.RLIMIT_NOFILE: 64, unix.RLIMIT_FSIZE: 4096} {
+		var limit unix.Rlimit
+		if err := unix.Prlimit(pid, resource, nil, &limit); err != nil {
+			t.Fatal(err)
+		}
+		if limit.Cur != expected || limit.Max != expected {
+			t.Errorf("expected limit %d of resource %d but got %+v", expected, resource, limit)
+		}
+	}
+}
+
+func TestLimitsViolations(t *testing.T) {
+	l := Limits{FileSizeBytes: 1024}
+	if v := l.Violations("SIGXFSZ", -1); len(v) != 1 {
+		t.Errorf("expected the file size violation of a killed script but got %v", v)
+	}
+	if v := l.Violations("", 128+int(unix.SIGXFSZ)); len(v) != 1 {
+		t.Errorf("expected the file size violation of a killed command but got %v", v)
+	}
+	if v := l.Violations("", 1); len(v) != 0 {
+		t.Errorf("expected no violation but got %v", v)
+	}
+	if v := (Limits{}).Violations("SIGXFSZ", -1); len(v) != 0 {
+		t.Errorf("expected no violation without limit but got %v", v)
+	}
+	// a crash isn't an address space violation
+	if v := (Limits{AddressSpaceBytes: 1 << 30, OpenFiles: 64}).Violations("SIGSEGV", -1); len(v) != 0 {
+		t.Errorf("expected no violation of a crashed script but got %v", v)
+	}
+}
+
+func TestCgroup(t *testing.T) {
+	// a fake cgroup hierarchy, whose interface files are regular files
+	parent := t.TempDir()
+	if _, err := NewCgroup("", "run-1", Limits{}); err == nil {
+		t.Error("expected error without parent cgroup")
+	}
+
+	cg, err := NewCgroup(parent, "run-1", Limits{CPUMax: "50000 100000", MemoryMaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cg.Add(1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for file, expected := range map[string]string{"cpu.max": "50000 100000", "memory.max": "1048576", "cgroup.procs": "1234"} {
+		contents, err := os.ReadFile(filepath.Join(parent, "run-1", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != expected {
+			t.Errorf("expected %q in %s but got %q", expected, file, contents)
+		}
+	}
+
+	violations, err := cg.Violations()
+	if err != nil || len(violations) != 0 {
+		t.Errorf("expected no violation but got %v: %v", violations, err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "run-1", "memory.events"), []byte("low 0\nhigh 0\nmax 12\noom 2\noom_kill 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "run-1", "cpu.stat"), []byte("usage_usec 200\nnr_periods 10\nnr_throttled 4\nthrottled_usec 1500000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	violations, err = cg.Violations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"memory.max exceeded 2 times, 1 processes killed", "cpu.max throttled 4 periods, for 1.5s"}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("expected %v but got %v", expected, violations)
+	}
+}
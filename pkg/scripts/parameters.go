@@ -0,0 +1,229 @@
+package scripts
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParameterType is the type of the values of a script parameter
+type ParameterType string
+
+const (
+	// IntParameter values are integers, optionally bounded by Min and Max
+	IntParameter ParameterType = "int"
+	// EnumParameter values are one of Values
+	EnumParameter ParameterType = "enum"
+	// DurationParameter values are durations such as 90s or 5m, optionally bounded
+	// by Min and Max, and passed to the script as a number of seconds
+	DurationParameter ParameterType = "duration"
+)
+
+// parameterNameRegexp restricts parameter names to environment variable names
+var parameterNameRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// reservedParameterNames can't be overridden by parameters, as they change the
+// behavior of the shell, of the dynamic linker, or are set by the agent
+var reservedParameterNames = map[string]bool{
+	"PATH":           true,
+	"HOME":           true,
+	"IFS":            true,
+	"ENV":            true,
+	"BASH_ENV":       true,
+	"SHELLOPTS":      true,
+	"BASHOPTS":       true,
+	"PS4":            true,
+	"CDPATH":         true,
+	"GLOBIGNORE":     true,
+	"NODE_IP":        true,
+	"EXECUTE_SCRIPT": true,
+	"RUN_ID":         true,
+	"OUTPUT_DIR":     true,
+}
+
+// Parameter declares a value which can be set in the scripting requests, passed to the
+// script as the environment variable of the same name
+type Parameter struct {
+	// Name of the parameter, and of its environment variable
+	Name        string
+	Type        ParameterType
+	Description string
+	// Default is the value of the parameter when not set by the request,
+	// the parameter is required if empty
+	Default string
+	// Min and Max bound the int and duration values
+	Min string
+	Max string
+	// Values are the allowed values of the enum parameters
+	Values []string
+}
+
+// validate checks the declaration of the parameter, including its default value
+func (p Parameter) validate() error {
+	if !parameterNameRegexp.MatchString(p.Name) {
+		return fmt.Errorf("name must consist of upper case alphanumeric characters or '_'")
+	}
+	if reservedParameterNames[p.Name] || strings.HasPrefix(p.Name, "LD_") {
+		return fmt.Errorf("name %s is reserved", p.Name)
+	}
+	switch p.Type {
+	case IntParameter, DurationParameter:
+		if len(p.Values) > 0 {
+			return fmt.Errorf("values can only be set for enum parameters")
+		}
+		min, max, err := p.bounds()
+		if err != nil {
+			return err
+		}
+		if min != nil && max != nil && *min > *max {
+			return fmt.Errorf("min %s is greater than max %s", p.Min, p.Max)
+		}
+	case EnumParameter:
+		if len(p.Values) == 0 {
+			return fmt.Errorf("enum parameters must list their values")
+		}
+		if p.Min != "" || p.Max != "" {
+			return fmt.Errorf("min and max can only be set for int and duration parameters")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected %s, %s or %s", p.Type, IntParameter, EnumParameter, DurationParameter)
+	}
+	if p.Default != "" {
+		if _, err := p.envValue(p.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return nil
+}
+
+// parse parses an int or a duration value, durations being returned in seconds
+func (p Parameter) parse(value string) (int64, error) {
+	if p.Type == DurationParameter {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration", value)
+		}
+		if d%time.Second != 0 {
+			return 0, fmt.Errorf("%q is not a whole number of seconds", value)
+		}
+		return int64(d / time.Second), nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an integer", value)
+	}
+	return i, nil
+}
+
+// bounds parses Min and Max, nil if not set
+func (p Parameter) bounds() (*int64, *int64, error) {
+	var min, max *int64
+	if p.Min != "" {
+		v, err := p.parse(p.Min)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid min: %w", err)
+		}
+		min = &v
+	}
+	if p.Max != "" {
+		v, err := p.parse(p.Max)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid max: %w", err)
+		}
+		max = &v
+	}
+	return min, max, nil
+}
+
+// envValue validates the value, and returns the value of the
+// environment variable: durations are converted to seconds
+func (p Parameter) envValue(value string) (string, error) {
+	if p.Type == EnumParameter {
+		for _, v := range p.Values {
+			if v == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%q is not one of %s", value, strings.Join(p.Values, ", "))
+	}
+
+	v, err := p.parse(value)
+	if err != nil {
+		return "", err
+	}
+	min, max, err := p.bounds()
+	if err != nil {
+		return "", err
+	}
+	if (min != nil && v < *min) || (max != nil && v > *max) {
+		return "", fmt.Errorf("%q is out of range [%s, %s]", value, p.Min, p.Max)
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// Env validates the values of the parameters set in a scripting request, and returns
+// the environment variables of the script, NAME=value, including the default values.
+// Values are passed as is to the script, they are never interpreted by a shell.
+func (s Script) Env(values map[string]string) ([]string, error) {
+	declared := map[string]bool{}
+	numbers := map[string]int64{}
+	env := []string{}
+	for _, p := range s.Parameters {
+		declared[p.Name] = true
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Default == "" {
+				return nil, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			value = p.Default
+		}
+		envValue, err := p.envValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %s: %w", p.Name, err)
+		}
+		env = append(env, p.Name+"="+envValue)
+		if p.Type != EnumParameter {
+			numbers[p.Name], _ = strconv.ParseInt(envValue, 10, 64)
+		}
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters %s for script %s", strings.Join(unknown, ", "), s.Name)
+	}
+	if err := s.checkRuntime(numbers); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// checkRuntime returns an error if the runtime of the script, the product of its Runtime
+// parameters, is more than 4/5 of its timeout: the rest is left to the collections
+// themselves and to the archiving of the outputs.
+func (s Script) checkRuntime(numbers map[string]int64) error {
+	if len(s.Runtime) == 0 {
+		return nil
+	}
+	runtime := int64(1)
+	for _, name := range s.Runtime {
+		runtime *= numbers[name]
+		// stop before an overflow, the runtime is already too long
+		if runtime > int64(s.Timeout()) {
+			break
+		}
+	}
+	if runtime*5 > int64(s.Timeout())*4 {
+		return fmt.Errorf("the runtime of script %s, %s, exceeds 4/5 of its timeout of %ds",
+			s.Name, strings.Join(s.Runtime, "*"), s.Timeout())
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package scripts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParameterValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		parameter     Parameter
+		expectedError bool
+	}{
+		{
+			name:      "int parameter",
+			parameter: Parameter{Name: "ITERATIONS", Type: IntParameter, Default: "10", Min: "1", Max: "100"},
+		},
+		{
+			name:      "unbounded duration parameter",
+			parameter: Parameter{Name: "DELAY", Type: DurationParameter},
+		},
+		{
+			name:      "enum parameter",
+			parameter: Parameter{Name: "MODE", Type: EnumParameter, Default: "fast", Values: []string{"fast", "slow"}},
+		},
+		{
+			name:          "lower case name",
+			parameter:     Parameter{Name: "delay", Type: DurationParameter},
+			expectedError: true,
+		},
+		{
+			name:          "reserved name",
+			parameter:     Parameter{Name: "PATH", Type: EnumParameter, Values: []string{"/tmp"}},
+			expectedError: true,
+		},
+		{
+			name:          "dynamic linker variable",
+			parameter:     Parameter{Name: "LD_PRELOAD", Type: EnumParameter, Values: []string{"/tmp/lib.so"}},
+			expectedError: true,
+		},
+		{
+			name:          "unknown type",
+			parameter:     Parameter{Name: "DELAY", Type: "string"},
+			expectedError: true,
+		},
+		{
+			name:          "enum without values",
+			parameter:     Parameter{Name: "MODE", Type: EnumParameter},
+			expectedError: true,
+		},
+		{
+			name:          "min greater than max",
+			parameter:     Parameter{Name: "DELAY", Type: DurationParameter, Min: "1m", Max: "10s"},
+			expectedError: true,
+		},
+		{
+			name:          "default out of range",
+			parameter:     Parameter{Name: "ITERATIONS", Type: IntParameter, Default: "0", Min: "1"},
+			expectedError: true,
+		},
+		{
+			name:          "default not in the enum",
+			parameter:     Parameter{Name: "MODE", Type: EnumParameter, Default: "medium", Values: []string{"fast", "slow"}},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.parameter.validate()
+			if tc.expectedError && err == nil {
+				t.Error("expected error but there were none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestScriptEnv(t *testing.T) {
+	s := Script{
+		Name: "monitor",
+		Parameters: []Parameter{
+			{Name: "DELAY", Type: DurationParameter, Default: "5s", Min: "1s", Max: "1m"},
+			{Name: "ITERATIONS", Type: IntParameter, Min: "1", Max: "100"},
+			{Name: "MODE", Type: EnumParameter, Default: "fast", Values: []string{"fast", "slow"}},
+		},
+	}
+	testCases := []struct {
+		name          string
+		values        map[string]string
+		expectedEnv   []string
+		expectedError bool
+	}{
+		{
+			name:        "default values",
+			values:      map[string]string{"ITERATIONS": "10"},
+			expectedEnv: []string{"DELAY=5", "ITERATIONS=10", "MODE=fast"},
+		},
+		{
+			name:        "durations are passed in seconds",
+			values:      map[string]string{"DELAY": "1m", "ITERATIONS": "100", "MODE": "slow"},
+			expectedEnv: []string{"DELAY=60", "ITERATIONS=100", "MODE=slow"},
+		},
+		{
+			name:          "missing required parameter",
+			values:        map[string]string{},
+			expectedError: true,
+		},
+		{
+			name:          "unknown parameter",
+			values:        map[string]string{"ITERATIONS": "10", "PATH": "/tmp"},
+			expectedError: true,
+		},
+		{
+			name:          "shell injection",
+			values:        map[string]string{"ITERATIONS": "10; rm -rf /"},
+			expectedError: true,
+		},
+		{
+			name:          "int out of range",
+			values:        map[string]string{"ITERATIONS": "101"},
+			expectedError: true,
+		},
+		{
+			name:          "duration out of range",
+			values:        map[string]string{"ITERATIONS": "10", "DELAY": "500ms"},
+			expectedError: true,
+		},
+		{
+			name:          "fractional duration",
+			values:        map[string]string{"ITERATIONS": "10", "DELAY": "1.5s"},
+			expectedError: true,
+		},
+		{
+			name:          "value not in the enum",
+			values:        map[string]string{"ITERATIONS": "10", "MODE": "$(reboot)"},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := s.Env(tc.values)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected error but got %v", env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(env, tc.expectedEnv) {
+				t.Errorf("expected %v but got %v", tc.expectedEnv, env)
+			}
+		})
+	}
+}
+
+func TestScriptRuntime(t *testing.T) {
+	s := Script{
+		Name:           "monitor",
+		TimeoutSeconds: 900,
+		Parameters: []Parameter{
+			{Name: "DELAY", Type: DurationParameter, Default: "5s", Min: "1s", Max: "1m"},
+			{Name: "ITERATIONS", Type: IntParameter, Default: "120", Min: "1", Max: "720"},
+		},
+		Runtime: []string{"DELAY", "ITERATIONS"},
+	}
+	testCases := []struct {
+		name          string
+		values        map[string]string
+		expectedError bool
+	}{
+		{name: "default values", values: map[string]string{}},
+		{name: "runtime at 4/5 of the timeout", values: map[string]string{"DELAY": "1m", "ITERATIONS": "12"}},
+		{name: "runtime beyond 4/5 of the timeout", values: map[string]string{"DELAY": "1m", "ITERATIONS": "13"}, expectedError: true},
+		{name: "maximum values", values: map[string]string{"DELAY": "1m", "ITERATIONS": "720"}, expectedError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.Env(tc.values)
+			if tc.expectedError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
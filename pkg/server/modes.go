@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ProfilingMode enables the profiling of kubelet, CRIO and the pprof targets
+	ProfilingMode = "profiling"
+	// ScriptingMode enables the execution of the metrics script
+	ScriptingMode = "scripting"
+)
+
+// Modes holds the features enabled in the agent
+type Modes struct {
+	Profiling bool
+	Scripting bool
+}
+
+// ParseModes parses the mode of the agent: a comma separated
+// list of modes, such as "profiling,scripting" to enable both
+func ParseModes(mode string) (Modes, error) {
+	modes := Modes{}
+	for _, m := range strings.Split(mode, ",") {
+		switch strings.TrimSpace(m) {
+		case ProfilingMode:
+			modes.Profiling = true
+		case ScriptingMode:
+			modes.Scripting = true
+		default:
+			return Modes{}, fmt.Errorf("unknown mode %q, expected a comma separated list of %s and %s", m, ProfilingMode, ScriptingMode)
+		}
+	}
+	return modes, nil
+}
+
+// String returns the comma separated list of the enabled modes
+func (m Modes) String() string {
+	modes := []string{}
+	if m.Profiling {
+		modes = append(modes, ProfilingMode)
+	}
+	if m.Scripting {
+		modes = append(modes, ScriptingMode)
+	}
+	return strings.Join(modes, ",")
+}
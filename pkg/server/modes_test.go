@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/openshift/node-observability-agent/pkg/handlers"
+)
+
+func TestParseModes(t *testing.T) {
+	testCases := []struct {
+		mode          string
+		expected      Modes
+		expectedError bool
+	}{
+		{mode: "profiling", expected: Modes{Profiling: true}},
+		{mode: "scripting", expected: Modes{Scripting: true}},
+		{mode: "profiling,scripting", expected: Modes{Profiling: true, Scripting: true}},
+		{mode: "scripting, profiling", expected: Modes{Profiling: true, Scripting: true}},
+		{mode: "", expectedError: true},
+		{mode: "profiling,tracing", expectedError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			modes, err := ParseModes(tc.mode)
+			if tc.expectedError && err == nil {
+				t.Error("expected error but there were none")
+			}
+			if !tc.expectedError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if modes != tc.expected {
+				t.Errorf("expected modes %v but got %v", tc.expected, modes)
+			}
+		})
+	}
+}
+
+func TestSetupRoutes(t *testing.T) {
+	testCases := []struct {
+		mode              string
+		expectedProfiling bool
+		expectedScripting bool
+		expectedMode      string
+	}{
+		{mode: "profiling", expectedProfiling: true, expectedMode: "profiling"},
+		{mode: "scripting", expectedScripting: true, expectedMode: "scripting"},
+		{mode: "profiling,scripting", expectedProfiling: true, expectedScripting: true, expectedMode: "profiling,scripting"},
+		{mode: "scripting,profiling,scripting", expectedProfiling: true, expectedScripting: true, expectedMode: "profiling,scripting"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			r, err := setupRoutes(Config{Mode: tc.mode, StorageFolder: t.TempDir(), NodeIP: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for path, expected := range map[string]bool{
+				"/node-observability-pprof":                                            tc.expectedProfiling,
+				"/node-observability-scripting":                                        tc.expectedScripting,
+				"/node-observability-runs/0f8fad5b-d9cb-469f-a165-70867728950e/output": tc.expectedScripting,
+				"/node-observability-status":                                           true,
+				"/node-observability-runs":                                             true,
+			} {
+				var match mux.RouteMatch
+				// the unknown paths match the not found handler, with an error
+				if matched := r.Match(httptest.NewRequest("GET", "http://localhost"+path, nil), &match) && match.MatchErr == nil; matched != expected {
+					t.Errorf("expected route %s to be registered: %v, but was %v", path, expected, matched)
+				}
+			}
+
+			req := httptest.NewRequest("GET", "http://localhost/node-observability-status", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var doc handlers.StatusDocument
+			if err := json.NewDecoder(w.Result().Body).Decode(&doc); err != nil {
+				t.Fatalf("unable to decode status: %v", err)
+			}
+			if doc.Mode != tc.expectedMode {
+				t.Errorf("expected mode %q but was %q", tc.expectedMode, doc.Mode)
+			}
+		})
+	}
+}
+
+// deadlineConn records the write deadlines set on the connection
+type deadlineConn struct {
+	net.Conn
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func TestSetupRoutesWriteDeadline(t *testing.T) {
+	r, err := setupRoutes(Config{Mode: "scripting", StorageFolder: t.TempDir(), NodeIP: "127.0.0.1", WriteTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		method       string
+		path         string
+		expectedCode int
+	}{
+		{method: http.MethodGet, path: "/node-observability-runs", expectedCode: http.StatusOK},
+		{method: http.MethodGet, path: "/unknown", expectedCode: http.StatusNotFound},
+		{method: http.MethodPost, path: "/metrics", expectedCode: http.StatusMethodNotAllowed},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			conn := &deadlineConn{}
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			req = req.WithContext(handlers.ConnContext(context.Background(), conn))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status code %d but was %d", tc.expectedCode, w.Code)
+			}
+			if len(conn.deadlines) != 1 || time.Until(conn.deadlines[0]) <= 0 {
+				t.Errorf("expected the write deadline to be set but got %v", conn.deadlines)
+			}
+		})
+	}
+}
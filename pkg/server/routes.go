@@ -1,21 +1,76 @@
 package server
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/gorilla/mux"
 
 	"github.com/openshift/node-observability-agent/pkg/handlers"
 )
 
-func setupRoutes(cfg Config) *mux.Router {
+// setupRoutes registers the endpoints of the enabled modes. When both the profiling
+// and the scripting modes are enabled, they share the same handlers: the same storage
+// folder, run history and lock.
+func setupRoutes(cfg Config) (*mux.Router, error) {
+	modes, err := ParseModes(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+
 	r := mux.NewRouter()
-	if cfg.Mode == "profiling" {
-		h := handlers.NewHandlers(cfg.Token, cfg.CACerts, cfg.StorageFolder, cfg.CrioUnixSocket, cfg.NodeIP, cfg.CrioPreferUnixSocket)
+	r.Use(handlers.WriteDeadline(cfg.WriteTimeout))
+	// the middlewares don't run for the requests which match no route
+	r.NotFoundHandler = handlers.WriteDeadline(cfg.WriteTimeout)(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = handlers.WriteDeadline(cfg.WriteTimeout)(http.HandlerFunc(methodNotAllowed))
+	var h *handlers.Handlers
+	if modes.Profiling {
+		h = handlers.NewHandlers(cfg.Token, cfg.CACerts, cfg.StorageFolder, cfg.CrioUnixSocket, cfg.NodeIP, cfg.CrioPreferUnixSocket, cfg.TraceMaxBytes)
+		if err := h.RegisterPprofTargets(cfg.PprofTargets...); err != nil {
+			return nil, fmt.Errorf("unable to register pprof targets: %w", err)
+		}
+		if err := h.RegisterSamplers(cfg.Roots); err != nil {
+			return nil, fmt.Errorf("unable to register samplers: %w", err)
+		}
 		r.HandleFunc("/node-observability-pprof", h.HandleProfiling)
-		r.HandleFunc("/node-observability-status", h.Status)
-	} else if cfg.Mode == "scripting" {
-		h := handlers.NewScriptingHandlers(cfg.StorageFolder, cfg.NodeIP)
+	}
+	if modes.Scripting {
+		if h == nil {
+			h = handlers.NewScriptingHandlers(cfg.StorageFolder, cfg.NodeIP)
+		} else {
+			h.EnableScripting()
+		}
+		h.ScriptCatalog = cfg.ScriptCatalog
+		h.ScriptCgroupParent = cfg.ScriptCgroupParent
+		h.ScriptAllowlist = cfg.ScriptAllowlist
 		r.HandleFunc("/node-observability-scripting", h.HandleScripting)
-		r.HandleFunc("/node-observability-status", h.Status)
+		r.HandleFunc("/node-observability-scripts", h.ListScripts).Methods(http.MethodGet)
+		r.HandleFunc("/node-observability-runs/{id}/output", h.StreamOutput).Methods(http.MethodGet)
 	}
-	return r
+	h.Mode = modes.String()
+	setupCommonRoutes(r, h, cfg)
+	return r, nil
+}
+
+// setupCommonRoutes registers the endpoints served in all the modes
+func setupCommonRoutes(r *mux.Router, h *handlers.Handlers, cfg Config) {
+	h.AdminToken = cfg.AdminToken
+	h.QueueSize = cfg.QueueSize
+	r.HandleFunc("/node-observability-status", h.Status)
+	r.HandleFunc("/metrics", h.Metrics).Methods(http.MethodGet)
+	r.HandleFunc("/node-observability-runs", h.ListRuns).Methods(http.MethodGet)
+	r.HandleFunc("/node-observability-runs/{id}", h.GetRun).Methods(http.MethodGet)
+	r.HandleFunc("/node-observability-runs/{id}/cancel", h.CancelRun).Methods(http.MethodPost)
+	r.HandleFunc("/node-observability-runs/{id}/artifacts", h.ListArtifacts).Methods(http.MethodGet)
+	r.HandleFunc("/node-observability-runs/{id}/artifacts.tar.gz", h.GetArtifactsArchive).Methods(http.MethodGet)
+	r.HandleFunc("/node-observability-runs/{id}/artifacts/{name:.+}", h.GetArtifact).Methods(http.MethodGet, http.MethodHead)
+	// clearing the error is only possible when an admin token is configured
+	if cfg.AdminToken != "" {
+		r.HandleFunc("/node-observability-error", h.ClearError).Methods(http.MethodDelete)
+	}
+}
+
+// methodNotAllowed sends HTTP 405, as the router does when no MethodNotAllowedHandler is set
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
 }
@@ -14,6 +14,10 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/node-observability-agent/pkg/collectors"
+	"github.com/openshift/node-observability-agent/pkg/handlers"
+	"github.com/openshift/node-observability-agent/pkg/scripts"
 )
 
 const loopback = "127.0.0.1"
@@ -26,29 +30,50 @@ type Config struct {
 	UnixSocket           string
 	PreferUnixSocket     bool
 	Token                string
+	AdminToken           string
 	CACerts              *x509.CertPool
 	NodeIP               string
 	StorageFolder        string
 	CrioUnixSocket       string
 	CrioPreferUnixSocket bool
 	Mode                 string
+	TraceMaxBytes        int64
+	PprofTargets         []*collectors.PprofTarget
+	// Roots are the mount points of the host filesystems read by the samplers
+	Roots collectors.Roots
+	// ScriptCatalog holds the scripts which can be run by name in scripting mode
+	ScriptCatalog *scripts.Catalog
+	// ScriptCgroupParent is the cgroup v2 directory holding the cgroups of the scripts
+	ScriptCgroupParent string
+	// ScriptAllowlist holds the digests of the scripts which can be run
+	ScriptAllowlist *scripts.Allowlist
+	// QueueSize is the number of runs which can wait for the ongoing run, 0 disables the queue
+	QueueSize int
+	// WriteTimeout bounds the time to send a response, including artifact downloads,
+	// and the time of each write of the followed script outputs
+	WriteTimeout time.Duration
 }
 
 // Start starts HTTP server with parameters in cfg structure
 func Start(cfg Config) error {
-	router := setupRoutes(cfg)
+	router, err := setupRoutes(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Clients must use TLS 1.2 or higher
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 	}
 
+	// the write timeout is set on each request by the router, so that
+	// the outputs of the scripts can be followed for longer
 	httpServer := &http.Server{
-		Handler:      router,
-		Addr:         fmt.Sprintf("%s:%d", loopback, cfg.Port),
-		TLSConfig:    tlsConfig,
-		ReadTimeout:  40 * time.Second,
-		WriteTimeout: 40 * time.Second,
+		Handler:     router,
+		Addr:        fmt.Sprintf("%s:%d", loopback, cfg.Port),
+		TLSConfig:   tlsConfig,
+		ReadTimeout: 40 * time.Second,
+		ConnContext: handlers.ConnContext,
 	}
 
 	network := "tcp"
@@ -2,9 +2,11 @@ package statelocker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -17,20 +19,29 @@ const (
 	Free    State = "FREE"
 	Taken   State = "TAKEN"
 	InError State = "ERROR"
+	// Queued is the state of a run waiting for the ongoing run to finish
+	Queued State = "QUEUED"
 )
 
 type StateLocker interface {
 	Lock() (uuid.UUID, State, error)
+	LockWithID(id uuid.UUID) (uuid.UUID, State, error)
 	SetError(runInError runs.Run) error
 	Unlock() error
 	LockInfo() (uuid.UUID, State, error)
+	LockTime() time.Time
+	ClearError(archive func(runs.Run) error) (runs.Run, error)
 }
 
+// ErrNotInError is returned when clearing the error of an agent which isn't in error
+var ErrNotInError = errors.New("agent is not in error")
+
 // StateLock struct holds the state of the agent service
 // and ensures its update in racy conditions
 type StateLock struct {
 	mux           *sync.Mutex
 	takerID       uuid.UUID
+	lockTime      time.Time
 	errorFilePath string
 }
 
@@ -53,6 +64,12 @@ func NewStateLock(pathToErr string) *StateLock {
 // a previous job is still running, InError is returned in case the errorFile exists
 // The last parameter returned is the error encountered, if any
 func (m *StateLock) Lock() (uuid.UUID, State, error) {
+	return m.LockWithID(uuid.New())
+}
+
+// LockWithID attempts to take the lock for the job of the given ID, the
+// ID of a run which was queued. It returns the same values as Lock.
+func (m *StateLock) LockWithID(id uuid.UUID) (uuid.UUID, State, error) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 	if m.takerID != uuid.Nil {
@@ -65,7 +82,8 @@ func (m *StateLock) Lock() (uuid.UUID, State, error) {
 		}
 		return uid, InError, nil
 	}
-	m.takerID = uuid.New()
+	m.takerID = id
+	m.lockTime = time.Now()
 	return m.takerID, Free, nil
 }
 
@@ -82,9 +100,18 @@ func (m *StateLock) Unlock() error {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 	m.takerID = uuid.Nil
+	m.lockTime = time.Time{}
 	return nil
 }
 
+// LockTime returns the time at which the ongoing job took the lock,
+// the zero time if the lock is free
+func (m *StateLock) LockTime() time.Time {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.lockTime
+}
+
 func (m *StateLock) LockInfo() (uuid.UUID, State, error) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -101,6 +128,29 @@ func (m *StateLock) LockInfo() (uuid.UUID, State, error) {
 	return m.takerID, Free, nil
 }
 
+// ClearError takes the agent out of the error state.
+// The run in error is read from the error file and handed to archive
+// before the file is removed: the agent stays in error if archive fails.
+// ErrNotInError is returned if the agent wasn't in error.
+func (m *StateLock) ClearError(archive func(runs.Run) error) (runs.Run, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !m.errorFileExists() {
+		return runs.Run{}, ErrNotInError
+	}
+	arun, err := m.readRunFromFile()
+	if err != nil {
+		return runs.Run{}, err
+	}
+	if err := archive(arun); err != nil {
+		return runs.Run{}, fmt.Errorf("unable to archive run %s: %w", arun.ID, err)
+	}
+	if err := os.Remove(m.errorFilePath); err != nil {
+		return runs.Run{}, fmt.Errorf("error removing %s file: %w", m.errorFilePath, err)
+	}
+	return arun, nil
+}
+
 func (m *StateLock) errorFileExists() bool {
 	if _, err := os.Stat(m.errorFilePath); err != nil {
 		return false
@@ -109,16 +159,21 @@ func (m *StateLock) errorFileExists() bool {
 }
 
 func (m *StateLock) readUIDFromFile() (uuid.UUID, error) {
-	var arun *runs.Run = &runs.Run{}
-	contents, err := os.ReadFile(m.errorFilePath)
+	arun, err := m.readRunFromFile()
 	if err != nil {
 		return uuid.Nil, err
 	}
-	err = json.Unmarshal(contents, arun)
+	return arun.ID, nil
+}
+
+func (m *StateLock) readRunFromFile() (runs.Run, error) {
+	var arun runs.Run
+	contents, err := os.ReadFile(m.errorFilePath)
 	if err != nil {
-		return uuid.Nil, err
+		return arun, err
 	}
-	return arun.ID, nil
+	err = json.Unmarshal(contents, &arun)
+	return arun, err
 }
 
 // G306 (CWE-276) - Mitigated
@@ -368,3 +368,87 @@ func TestErrorFileExists(t *testing.T) {
 		})
 	}
 }
+
+func TestClearError(t *testing.T) {
+	runInError := runs.Run{
+		ID: uuid.MustParse(validUID),
+		ExecutionRuns: []runs.ExecutionRun{
+			{
+				Type:       runs.KubeletRun,
+				Successful: false,
+				Error:      "fake error",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		inError       bool
+		archiveErr    error
+		expectedErr   bool
+		expectedState State
+	}{
+		{
+			name:          "not in error, ErrNotInError",
+			inError:       false,
+			expectedErr:   true,
+			expectedState: Free,
+		},
+		{
+			name:          "in error, run archived and error cleared",
+			inError:       true,
+			expectedState: Free,
+		},
+		{
+			name:          "in error, archive fails, stays in error",
+			inError:       true,
+			archiveErr:    fmt.Errorf("fake archive error"),
+			expectedErr:   true,
+			expectedState: InError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stateLock := NewStateLock(t.TempDir() + "/agent.err")
+			if tc.inError {
+				if err := stateLock.SetError(runInError); err != nil {
+					t.Fatalf("unexpected error preparing test: %v", err)
+				}
+			}
+
+			var archived runs.Run
+			arun, err := stateLock.ClearError(func(r runs.Run) error {
+				archived = r
+				return tc.archiveErr
+			})
+			if tc.expectedErr && err == nil {
+				t.Error("expected error but there were none")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("unexpected error : %v", err)
+			}
+			if !tc.inError && err != ErrNotInError {
+				t.Errorf("expected ErrNotInError but was %v", err)
+			}
+			if !tc.expectedErr && (arun.ID != runInError.ID || archived.ID != runInError.ID) {
+				t.Errorf("expected run %v to be returned and archived, but got %v and %v", runInError.ID, arun.ID, archived.ID)
+			}
+			if _, s, _ := stateLock.LockInfo(); s != tc.expectedState {
+				t.Errorf("expected state to be %s but was %s", tc.expectedState, s)
+			}
+		})
+	}
+}
+
+func TestLockWithID(t *testing.T) {
+	stateLock := NewStateLock(t.TempDir() + "/agent.err")
+	id := uuid.MustParse(validUID)
+	uid, s, err := stateLock.LockWithID(id)
+	if err != nil || s != Free || uid != id {
+		t.Fatalf("expected lock to be taken by %s, but got %s in state %s: %v", id, uid, s, err)
+	}
+	uid, s, err = stateLock.LockWithID(uuid.New())
+	if err != nil || s != Taken || uid != id {
+		t.Errorf("expected lock to be held by %s, but got %s in state %s: %v", id, uid, s, err)
+	}
+}
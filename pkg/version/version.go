@@ -15,3 +15,8 @@ func MakeVersionString() string {
 	return fmt.Sprintf("node-observability-agent version: %q, commit: %q, build date: %q, go version: %q, GOOS: %q, GOARCH: %q",
 		versionFromGit, commitFromGit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
 }
+
+// Version returns the version of the agent, as set at build time
+func Version() string {
+	return versionFromGit
+}
@@ -2,23 +2,19 @@
 #
 # This script is completly based on the KCS article https://access.redhat.com/solutions/5343671
 
-# Resolution in seconds
-RESOLUTION=5 
-# Duration in seconds (or whatever is acceptable as an argument to "sleep")
-DURATION=10
+# Resolution in seconds, set by the RESOLUTION parameter of the catalog
+RESOLUTION=${RESOLUTION:-5}
+# Duration in seconds, set by the DURATION parameter of the catalog
+DURATION=${DURATION:-10}
+
+# The agent runs the script in the output directory of the run, everything written there is an artifact of the run
+cd "${OUTPUT_DIR:-.}" || exit 1
 
 now=$(date +%Y_%m_%d_%H)
-rm -rf "archives/"
 mkdir -p "archives"
-rm -rf results/*
-mkdir -p results
 
 #echo "Gathering metrics ..."
-if [ ! -d "$HOSTNAME-metrics_$now" ];
-then
-  mkdir $HOSTNAME-metrics_$now
-fi
-rm -Rf $HOSTNAME-metrics_$now/*
+mkdir -p $HOSTNAME-metrics_$now
 pidstat -p ALL -T ALL -I -l -r  -t  -u -w ${RESOLUTION} > "$HOSTNAME-metrics_$now/pidstat.txt" &
 PIDSTAT=$!
 sar -A ${RESOLUTION} > "$HOSTNAME-metrics_$now/sar.txt" &
@@ -31,8 +27,6 @@ bash -c "while true ; do date ; cat /proc/softirqs; sleep ${RESOLUTION}; done" >
 SOFTIRQS=$!
 bash -c "while true ; do date ; cat /proc/interrupts; sleep ${RESOLUTION}; done" > "$HOSTNAME-metrics_$now/interrupts.txt" &
 INTERRUPTS=$!
-iotop -Pobt > "$HOSTNAME-metrics_$now/iotop.txt" &
-IOTOP=$!
 #echo "Metrics gathering started. Please wait for completion..."
 sleep "${DURATION}"
 kill $PIDSTAT
@@ -41,7 +35,6 @@ kill $PS
 kill $FREE
 kill $SOFTIRQS
 kill $INTERRUPTS
-kill $IOTOP
  
 tar -czf archives/$HOSTNAME-metrics-$now.tar.gz  $HOSTNAME-metrics_$now/
  
@@ -1,12 +1,25 @@
 #!/bin/bash
+# Delay between collections in seconds, and number of collections,
+# set by the DELAY and ITERATIONS parameters of the catalog
+DELAY=${DELAY:-5}
+ITERATIONS=${ITERATIONS:-120}
+MONITOR_OPTS=""
+if [ "${SS_PROCESSES:-enabled}" = "disabled" ]; then
+  MONITOR_OPTS="-p"
+fi
+
+# The agent runs the script in the output directory of the run, everything written there is an artifact of the run
+cd "${OUTPUT_DIR:-.}" || exit 1
+MONITOR="$(dirname "$0")/monitor.sh"
+
 #echo "Gathering metrics ..."
-mkdir network-metrics
-rm -Rf network-metrics/*
+mkdir -p network-metrics
 #echo "Gathering monitor metrics ..."
 cd network-metrics
-bash -c "while true ; do date ; conntrack -L -n ; sleep 5; done" >> conntrack.txt &
+bash -c "while true ; do date ; conntrack -L -n ; sleep \"${DELAY}\"; done" >> conntrack.txt &
 CONNTRACK=$!
-bash /tmp/scripts/monitor.sh -d 5 -i 120
+bash "${MONITOR}" -d "${DELAY}" -i "${ITERATIONS}" ${MONITOR_OPTS}
 kill $CONNTRACK
-tar -czf /network-metrics.tar.gz /network-metrics
+cd ..
+tar -czf network-metrics.tar.gz network-metrics
 #echo "Done with network metrics collection."